@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	actionStatusOK      = "ok"
+	actionStatusWarning = "warning"
+	actionStatusError   = "error"
+)
+
+// actionRetryDelay is multiplied by the attempt to get the delay before retrying a retryable action.
+const actionRetryDelay = 500 * time.Millisecond
+
+// actionResult is the envelope of each result of the MigrateTable, DeleteStale, DeleteRecord and DeleteRecordBatch actions.
+// A result which isn't an envelope, e.g. `ok`, is treated as succeeded without affecting any rows.
+type actionResult struct {
+	// Status is `ok`, `warning` or `error`. An `error` with affected rows reports a partial failure.
+	Status       string `json:"status"`
+	AffectedRows int64  `json:"affected_rows,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Retryable    bool   `json:"retryable,omitempty"`
+}
+
+// ActionError is returned when the ArrowFlight service reports an action as failed in its result.
+type ActionError struct {
+	Action    string
+	TableName string
+	Message   string
+	// AffectedRows is the number of rows the action affected before it failed.
+	AffectedRows int64
+	// Retryable is set if the ArrowFlight service reported the action can be retried.
+	Retryable bool
+}
+
+func (e *ActionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s of table %s failed", e.Action, e.TableName)
+	if e.AffectedRows > 0 {
+		fmt.Fprintf(&b, " after affecting %d rows", e.AffectedRows)
+	}
+	if len(e.Message) > 0 {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	return b.String()
+}
+
+// isRetryable reports whether the error is an ActionError the ArrowFlight service reported as retryable.
+// Joined errors are retryable if all of them are.
+func isRetryable(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if !isRetryable(err) {
+				return false
+			}
+		}
+		return true
+	}
+	var actionErr *ActionError
+	return errors.As(err, &actionErr) && actionErr.Retryable
+}
+
+// doTableAction sends the action of the table and returns the number of rows affected by all its results.
+// Actions failing with a retryable ActionError are retried up to maxRetries times.
+func (c *Client) doTableAction(ctx context.Context, actionType, tableName string, body []byte) (int64, error) {
+	for attempt := 1; ; attempt++ {
+		bodies, err := c.doActionResults(ctx, actionType, tableName, body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to doAction: %w", err)
+		}
+		affectedRows, err := c.actionResults(ctx, actionType, tableName, bodies)
+		if !isRetryable(err) || attempt > maxRetries {
+			return affectedRows, err
+		}
+		c.logger.Warn().Err(err).Str("tableName", tableName).Int("attempt", attempt).Msg("action failed, retrying")
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(attempt) * actionRetryDelay):
+		}
+	}
+}
+
+// actionResults reads the envelopes of the results of the action, logging warnings and recording the affected rows.
+// Every result is read, so a failure reported after other results isn't missed.
+func (c *Client) actionResults(ctx context.Context, actionType, tableName string, bodies [][]byte) (int64, error) {
+	var affectedRows int64
+	var errs []error
+	for _, body := range bodies {
+		var result actionResult
+		if err := json.Unmarshal(body, &result); err != nil || len(result.Status) == 0 {
+			c.logger.Debug().Str("tableName", tableName).Str("action", actionType).Str("body", string(body)).Msg("action result")
+			continue
+		}
+		affectedRows += result.AffectedRows
+		switch result.Status {
+		case actionStatusOK:
+			c.logger.Debug().Str("tableName", tableName).Str("action", actionType).Int64("affectedRows", result.AffectedRows).Msg("action result")
+		case actionStatusWarning:
+			c.logger.Warn().Str("tableName", tableName).Str("action", actionType).Int64("affectedRows", result.AffectedRows).Str("reason", result.Message).Msg("action succeeded with a warning")
+		default:
+			if result.Status != actionStatusError {
+				result.Message = fmt.Sprintf("unknown status %q: %s", result.Status, result.Message)
+			}
+			errs = append(errs, &ActionError{
+				Action:       actionType,
+				TableName:    tableName,
+				Message:      result.Message,
+				AffectedRows: result.AffectedRows,
+				Retryable:    result.Retryable,
+			})
+		}
+	}
+	c.metrics.recordAffectedRows(ctx, actionType, tableName, affectedRows)
+	if len(errs) > 0 {
+		c.metrics.recordActionFailure(ctx, actionType, tableName)
+	}
+	return affectedRows, errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ActionResults(t *testing.T) {
+	tests := []struct {
+		name             string
+		results          [][]string
+		wantErr          *ActionError
+		wantActions      int
+		wantAffectedRows int64
+	}{
+		{
+			name:             "should sum the affected rows of every result",
+			results:          [][]string{{`{"status": "ok", "affected_rows": 2}`, `{"status": "ok", "affected_rows": 3}`}},
+			wantActions:      1,
+			wantAffectedRows: 5,
+		},
+		{
+			name:             "should accept results which aren't envelopes",
+			results:          [][]string{{"ok"}},
+			wantActions:      1,
+			wantAffectedRows: 0,
+		},
+		{
+			name:             "should succeed with a warning",
+			results:          [][]string{{`{"status": "warning", "affected_rows": 1, "message": "table is empty"}`}},
+			wantActions:      1,
+			wantAffectedRows: 1,
+		},
+		{
+			name:    "should fail for a failure after another result",
+			results: [][]string{{`{"status": "ok", "affected_rows": 2}`, `{"status": "error", "affected_rows": 1, "message": "lock timeout"}`}},
+			wantErr: &ActionError{
+				Action:       deleteRecord,
+				TableName:    "test_action_results",
+				Message:      "lock timeout",
+				AffectedRows: 1,
+			},
+			wantActions:      1,
+			wantAffectedRows: 3,
+		},
+		{
+			name:    "should fail for an unknown status",
+			results: [][]string{{`{"status": "partial"}`}},
+			wantErr: &ActionError{
+				Action:    deleteRecord,
+				TableName: "test_action_results",
+				Message:   `unknown status "partial": `,
+			},
+			wantActions: 1,
+		},
+		{
+			name:             "should retry a retryable failure",
+			results:          [][]string{{`{"status": "error", "message": "busy", "retryable": true}`}, {`{"status": "ok", "affected_rows": 4}`}},
+			wantActions:      2,
+			wantAffectedRows: 4,
+		},
+		{
+			name:    "should give up retrying",
+			results: [][]string{{`{"status": "error", "message": "busy", "retryable": true}`}},
+			wantErr: &ActionError{
+				Action:    deleteRecord,
+				TableName: "test_action_results",
+				Message:   "busy",
+				Retryable: true,
+			},
+			wantActions: maxRetries + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			defer server.release()
+			server.actionResults = map[string][][]string{deleteRecord: tt.results}
+			c := newTestClient(t, newTestFlightServer(t, server), nil)
+			ctx := context.Background()
+
+			err := c.DeleteRecord(ctx, testDeleteRecord("test_action_results"))
+			require.NoError(t, c.Close(ctx))
+
+			if tt.wantErr != nil {
+				var actionErr *ActionError
+				require.ErrorAs(t, err, &actionErr)
+				assert.Equal(t, tt.wantErr, actionErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantActions, countActions(server.actionTypes(), deleteRecord))
+			assert.Equal(t, tt.wantAffectedRows, c.metrics.tables["test_action_results"].affectedRows)
+		})
+	}
+}
+
+func TestActionError(t *testing.T) {
+	err := &ActionError{Action: deleteStale, TableName: "test_table", Message: "lock timeout", AffectedRows: 2}
+	assert.EqualError(t, err, "DeleteStale of table test_table failed after affecting 2 rows: lock timeout")
+	assert.False(t, isRetryable(err))
+	assert.True(t, isRetryable(&ActionError{Retryable: true}))
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getCapabilities = "GetCapabilities"
+)
+
+// capabilities are advertised by the server in response to the GetCapabilities action.
+type capabilities struct {
+	WriteModes []string `json:"write_modes,omitempty"`
+}
+
+// dependsOnCapabilities reports whether any option is checked against the capabilities of the server.
+// Otherwise the capabilities aren't loaded, so the client keeps connecting lazily.
+func (c *Client) dependsOnCapabilities() bool {
+	return len(c.spec.WriteMode) > 0
+}
+
+// loadCapabilities asks the server for its capabilities. Servers which don't implement the action are assumed to support everything.
+func (c *Client) loadCapabilities(ctx context.Context) error {
+	c.logger.Debug().Msg("get capabilities")
+	body, err := c.doAction(ctx, getCapabilities, "", nil)
+	if status.Code(err) == codes.Unimplemented {
+		c.logger.Debug().Err(err).Msg("server doesn't advertise capabilities")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to doAction: %w", err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	var caps capabilities
+	if err = json.Unmarshal(body, &caps); err != nil {
+		c.logger.Warn().Err(err).Str("body", string(body)).Msg("failed to decode capabilities, assuming the server supports everything")
+		return nil
+	}
+	c.capabilities = &caps
+	c.logger.Debug().Strs("writeModes", caps.WriteModes).Msg("capabilities")
+
+	return nil
+}
+
+// supportsWriteMode reports whether the server advertised support for the write mode.
+func (c *Client) supportsWriteMode(writeMode string) bool {
+	if c.capabilities == nil || len(c.capabilities.WriteModes) == 0 {
+		return true
+	}
+	return slices.Contains(c.capabilities.WriteModes, writeMode)
+}
+
+func (c *Client) checkCapabilities() error {
+	if len(c.spec.WriteMode) > 0 && !c.supportsWriteMode(c.spec.WriteMode) {
+		return fmt.Errorf("write mode %q is not supported by the server, supported write modes: %s", c.spec.WriteMode, strings.Join(c.capabilities.WriteModes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/cloudquery/plugin-sdk/v4/plugin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_WriteModeCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities *capabilities
+		failAction   string
+		writeMode    string
+		wantErr      string
+	}{
+		{
+			name:      "should accept any write mode without capabilities",
+			writeMode: "overwrite-delete-stale",
+		},
+		{
+			name:         "should accept an advertised write mode",
+			capabilities: &capabilities{WriteModes: []string{"append", "overwrite"}},
+			writeMode:    "overwrite",
+		},
+		{
+			name:         "should refuse a write mode which isn't advertised",
+			capabilities: &capabilities{WriteModes: []string{"append"}},
+			writeMode:    "overwrite",
+			wantErr:      `write mode "overwrite" is not supported by the server, supported write modes: append`,
+		},
+		{
+			name:       "should fail if the server fails the action",
+			failAction: getCapabilities,
+			writeMode:  "overwrite",
+			wantErr:    "failed to load capabilities: failed to doAction: failed to receive doAction result: rpc error: code = Internal desc = failed to GetCapabilities",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			server.capabilities = tt.capabilities
+			server.failAction = tt.failAction
+			b, err := json.Marshal(map[string]any{
+				"addr":       newTestFlightServer(t, server),
+				"write_mode": tt.writeMode,
+			})
+			require.NoError(t, err)
+
+			c, err := New(context.Background(), zerolog.New(os.Stdout), b, plugin.NewClientOptions{})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, c.Close(context.Background()))
+		})
+	}
+}
+
+func TestNew_LazyConnection(t *testing.T) {
+	server := newTestFlightService()
+	c := newTestClient(t, newTestFlightServer(t, server), nil)
+	require.NoError(t, c.Close(context.Background()))
+	assert.Empty(t, server.actionTypes())
+
+	// Without options depending on the capabilities, the service doesn't need to be reachable yet.
+	c = newTestClient(t, unusedAddr(t), nil)
+	require.NoError(t, c.Close(context.Background()))
+}
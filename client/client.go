@@ -2,28 +2,40 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/memory"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
 	"github.com/rs/zerolog"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
 )
 
 type Client struct {
-	flightClient flight.Client
-	logger       zerolog.Logger
-	mutex        sync.RWMutex
-	spec         spec.Spec
-	writers      map[string]*Writer
+	allocator        *trackingAllocator
+	capabilities     *capabilities
+	compat           *typeCompat
+	deletes          *deleteBatcher
+	dryRun           *dryRun
+	flightClient     flight.Client
+	inFlightLimiter  *inFlightLimiter
+	logger           zerolog.Logger
+	masks            []*mask
+	metrics          *clientMetrics
+	mutex            sync.RWMutex
+	namer            *namer
+	nester           *nester
+	normalizer       *normalizer
+	router           *router
+	spec             spec.Spec
+	targets          []*target
+	transactionID    string
+	transactionMutex sync.RWMutex
+	writers          map[string]*Writer
 
 	plugin.UnimplementedSource
 }
@@ -48,18 +60,94 @@ func New(ctx context.Context, logger zerolog.Logger, specBytes []byte, opts plug
 	}
 	c.spec.SetDefaults()
 
-	if err := c.connect(ctx); err != nil {
+	c.allocator = newTrackingAllocator(memory.DefaultAllocator, c.spec.MemoryLimit)
+
+	if len(c.spec.Targets) > 0 {
+		if err := c.initTargets(ctx); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	if err := c.init(ctx); err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
 
-func (c *Client) Close(context.Context) error {
-	if err := c.closeWriters(); err != nil {
+// init prepares the client for writing to a single ArrowFlight service and connects to it.
+func (c *Client) init(ctx context.Context) error {
+	c.inFlightLimiter = newInFlightLimiter(c.spec.MaxInFlightBatches, c.spec.MaxInFlightBytes)
+	{
+		var err error
+		if c.masks, err = newMasks(c.spec.Transforms); err != nil {
+			return err
+		}
+		c.compat = newTypeCompat(c.spec.TypeCompatibility)
+		c.normalizer = newNormalizer(c.spec.Normalization)
+		c.nester = newNester(c.spec.NestedColumns)
+		c.namer = newNamer(c.spec.Naming)
+		c.deletes = newDeleteBatcher(c)
+	}
+	{
+		var err error
+		if c.metrics, err = newClientMetrics(); err != nil {
+			return err
+		}
+	}
+	if c.spec.DryRun {
+		var err error
+		if c.dryRun, err = newDryRun(c.logger, c.allocator, c.spec.DryRunOutputDir); err != nil {
+			return err
+		}
+	}
+
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+
+	if !c.dependsOnCapabilities() {
+		return nil
+	}
+	if err := c.loadCapabilities(ctx); err != nil {
+		_ = c.flightClient.Close()
+		return fmt.Errorf("failed to load capabilities: %w", err)
+	}
+	if err := c.checkCapabilities(); err != nil {
+		_ = c.flightClient.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) Close(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, spanClientClose)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if len(c.targets) > 0 {
+		return c.closeTargets(ctx)
+	}
+
+	if err := c.deletes.flushAll(ctx); err != nil {
+		return fmt.Errorf("failed to flush delete records: %w", err)
+	}
+
+	if err := c.closeWriters(ctx); err != nil {
 		return fmt.Errorf("failed to close writers: %w", err)
 	}
 
+	if c.dryRun != nil {
+		if err := c.dryRun.close(); err != nil {
+			return err
+		}
+	}
+
+	c.metrics.logSummary(c.logger)
+
 	c.logger.Info().Msg("closing flight client")
 	if err := c.flightClient.Close(); err != nil {
 		return fmt.Errorf("failed to close flight client: %w", err)
@@ -76,33 +164,47 @@ func (c *Client) authenticate(ctx context.Context) error {
 	}
 
 	c.logger.Info().Msg("authenticating flight client")
-	if err := c.flightClient.Authenticate(ctx); err != nil {
-		return fmt.Errorf("failed to authenticate flight client: %w", err)
+	timeout := c.spec.Timeouts.Handshake.Duration()
+	handshakeCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	if err := c.flightClient.Authenticate(handshakeCtx); err != nil {
+		return fmt.Errorf("failed to authenticate flight client: %w", timeoutError(ctx, handshakeCtx, err, operationHandshake, "", timeout))
 	}
 
 	return nil
 }
 
-func (c *Client) closeWriters() error {
+// closeWriters closes the writers concurrently, so the close drains of the tables overlap instead of adding up.
+// The writers are taken from the client first, so the lock isn't held while they drain.
+func (c *Client) closeWriters(ctx context.Context) error {
 	c.logger.Info().Msg("closing writers")
 
 	c.logger.Debug().Msg("acquiring lock to close writers")
 	c.mutex.Lock()
 	c.logger.Debug().Msg("acquired lock to close writers")
-	defer c.mutex.Unlock()
-
-	var errs []error
-	for _, writer := range c.writers {
-		if err := writer.Close(); err != nil {
-			errs = append(errs, err)
-		}
+	writers := c.writers
+	c.writers = make(map[string]*Writer)
+	c.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(writers))
+	var errsMutex sync.Mutex
+	for _, writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := writer.Close(ctx); err != nil {
+				errsMutex.Lock()
+				errs = append(errs, err)
+				errsMutex.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
 	if err := errors.Join(errs...); err != nil {
 		return fmt.Errorf("failed to close writers: %w", err)
 	}
 
-	clear(c.writers)
-
 	return nil
 }
 
@@ -114,27 +216,10 @@ func (c *Client) connect(ctx context.Context) error {
 	c.logger.Debug().Msg("acquired lock to connect flight client")
 	defer c.mutex.Unlock()
 
-	var transportCredentials credentials.TransportCredentials
-	if c.spec.TlsEnabled {
-		transportCredentials = credentials.NewTLS(&tls.Config{
-			ServerName:         c.spec.TlsServerName,
-			InsecureSkipVerify: c.spec.TlsInsecureSkipVerify,
-		})
-	} else {
-		transportCredentials = insecure.NewCredentials()
-	}
-	grpcDialOptions := []grpc.DialOption{
-		grpc.WithTransportCredentials(transportCredentials),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(c.spec.MaxCallRecvMsgSize),
-			grpc.MaxCallSendMsgSize(c.spec.MaxCallSendMsgSize),
-		),
-	}
-
 	{
 		var err error
-		if c.flightClient, err = flight.NewClientWithMiddlewareCtx(ctx, c.spec.Addr, newAuthHandler(c.spec.Handshake, c.spec.Token), nil, grpcDialOptions...); err != nil {
-			return fmt.Errorf("failed to create flight client: %w", err)
+		if c.flightClient, err = newFlightClient(ctx, c.spec); err != nil {
+			return err
 		}
 	}
 
@@ -2,21 +2,21 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/apache/arrow-go/v18/arrow/flight"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
 	"github.com/rs/zerolog"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
 )
 
-func ConnectionTester(ctx context.Context, _ zerolog.Logger, specBytes []byte) error {
+func ConnectionTester(ctx context.Context, logger zerolog.Logger, specBytes []byte) error {
 	var s spec.Spec
 	if err := json.Unmarshal(specBytes, &s); err != nil {
 		return &plugin.TestConnError{
@@ -32,30 +32,76 @@ func ConnectionTester(ctx context.Context, _ zerolog.Logger, specBytes []byte) e
 		}
 	}
 
-	var transportCredentials credentials.TransportCredentials
-	if s.TlsEnabled {
-		transportCredentials = credentials.NewTLS(&tls.Config{
-			ServerName:         s.TlsServerName,
-			InsecureSkipVerify: s.TlsInsecureSkipVerify,
-		})
-	} else {
-		transportCredentials = insecure.NewCredentials()
+	if len(s.Targets) == 0 {
+		if err := testConnection(ctx, logger, s); err != nil {
+			return err
+		}
+		return nil
 	}
-	grpcDialOptions := []grpc.DialOption{
-		grpc.WithTransportCredentials(transportCredentials),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(s.MaxCallRecvMsgSize),
-			grpc.MaxCallSendMsgSize(s.MaxCallSendMsgSize),
-		),
+	for _, target := range s.Targets {
+		if err := testConnection(ctx, logger.With().Str("target", target.Name).Logger(), s.ForTarget(target)); err != nil {
+			return &plugin.TestConnError{
+				Code:    err.Code,
+				Message: fmt.Errorf("failed to connect target %s: %w", target.Name, err.Message),
+			}
+		}
 	}
+	return nil
+}
 
-	c, err := flight.NewClientWithMiddlewareCtx(ctx, s.Addr, newAuthHandler(s.Handshake, s.Token), nil, grpcDialOptions...)
-	if err != nil {
-		return err
+// testConnection connects to the ArrowFlight service, authenticates, checks it is reachable and checks its capabilities
+// if any option depends on them.
+func testConnection(ctx context.Context, logger zerolog.Logger, s spec.Spec) *plugin.TestConnError {
+	c := &Client{
+		logger: logger,
+		spec:   s,
+	}
+	if err := c.connect(ctx); err != nil {
+		return &plugin.TestConnError{
+			Code:    "CONNECTION_FAILED",
+			Message: err,
+		}
 	}
 	defer func(c flight.Client) {
 		_ = c.Close()
-	}(c)
+	}(c.flightClient)
 
+	if err := c.ping(ctx); err != nil {
+		return &plugin.TestConnError{
+			Code:    "CONNECTION_FAILED",
+			Message: fmt.Errorf("failed to reach ArrowFlight service: %w", err),
+		}
+	}
+	if !c.dependsOnCapabilities() {
+		return nil
+	}
+	if err := c.loadCapabilities(ctx); err != nil {
+		return &plugin.TestConnError{
+			Code:    "CONNECTION_FAILED",
+			Message: fmt.Errorf("failed to load capabilities: %w", err),
+		}
+	}
+	if err := c.checkCapabilities(); err != nil {
+		return &plugin.TestConnError{
+			Code:    "UNSUPPORTED_CAPABILITIES",
+			Message: err,
+		}
+	}
 	return nil
 }
+
+// ping checks the ArrowFlight service is reachable by listing its actions, as the connection is established lazily.
+// Services which don't implement ListActions are reachable as well. The call is limited by the `action` timeout.
+func (c *Client) ping(ctx context.Context) error {
+	timeout := c.spec.Timeouts.Action.Duration()
+	pingCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	stream, err := c.flightClient.ListActions(pingCtx, &flight.Empty{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if err == nil || errors.Is(err, io.EOF) || status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	return timeoutError(ctx, pingCtx, err, operationListActions, "", timeout)
+}
@@ -2,9 +2,11 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
 	"github.com/rs/zerolog"
@@ -31,6 +33,38 @@ func TestConnectionTester(t *testing.T) {
 				ErrorDescription: "failed to unmarshal spec: invalid character 'i' looking for beginning of value",
 			},
 		},
+		{
+			name:      "should return an error for a route to an unknown target",
+			specBytes: []byte(`{"targets": [{"name": "aws", "addr": "localhost:9090"}], "routes": [{"tables": ["aws_*"], "target": "gcp"}]}`),
+			wantErr: &wantErr{
+				Code:             "INVALID_SPEC",
+				ErrorDescription: `failed to validate spec: invalid route 0: unknown target "gcp"`,
+			},
+		},
+		{
+			name:      "should return an error for a target name which can't be a dry run directory",
+			specBytes: []byte(`{"targets": [{"name": "../aws", "addr": "localhost:9090"}], "dry_run": true, "dry_run_output_dir": "out"}`),
+			wantErr: &wantErr{
+				Code:             "INVALID_SPEC",
+				ErrorDescription: "failed to validate spec: target name \"../aws\" can't be used as a directory of `dry_run_output_dir`",
+			},
+		},
+		{
+			name:      "should return an error for a negative timeout",
+			specBytes: []byte(`{"addr": "localhost:9090", "timeouts": {"write": "-1s"}}`),
+			wantErr: &wantErr{
+				Code:             "INVALID_SPEC",
+				ErrorDescription: "failed to validate spec: `timeouts.write` must not be negative",
+			},
+		},
+		{
+			name:      "should return an error for a keepalive time below the gRPC minimum",
+			specBytes: []byte(`{"addr": "localhost:9090", "keepalive": {"time": "5s"}}`),
+			wantErr: &wantErr{
+				Code:             "INVALID_SPEC",
+				ErrorDescription: "failed to validate spec: `keepalive.time` must be at least 10s",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -60,3 +94,91 @@ func TestConnectionTester(t *testing.T) {
 		})
 	}
 }
+
+func TestConnectionTester_Targets(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	addr := newTestFlightServer(t, server)
+	unused := unusedAddr(t)
+
+	tests := []struct {
+		name    string
+		targets []map[string]any
+		wantErr string
+	}{
+		{
+			name: "should connect every target",
+			targets: []map[string]any{
+				{"name": "primary", "addr": addr},
+				{"name": "secondary", "addr": addr},
+			},
+		},
+		{
+			name: "should fail for an unreachable target",
+			targets: []map[string]any{
+				{"name": "primary", "addr": addr},
+				{"name": "secondary", "addr": unused},
+			},
+			wantErr: "failed to connect target secondary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specBytes, err := json.Marshal(map[string]any{"targets": tt.targets})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err = ConnectionTester(ctx, zerolog.Nop(), specBytes)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			var target *plugin.TestConnError
+			require.ErrorAs(t, err, &target)
+			assert.Equal(t, "CONNECTION_FAILED", target.Code)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	tests := []struct {
+		name       string
+		failAction string
+		stall      string
+		wantErr    string
+	}{
+		{
+			name: "should reach a service which doesn't implement ListActions",
+		},
+		{
+			name:       "should fail on a service failing ListActions",
+			failAction: operationListActions,
+			wantErr:    "rpc error: code = Internal desc = failed to list actions",
+		},
+		{
+			name:    "should time out a stalled ListActions",
+			stall:   operationListActions,
+			wantErr: "ListActions timed out after 50ms: rpc error: code = DeadlineExceeded desc = context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			server.failAction = tt.failAction
+			server.stall = tt.stall
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"timeouts": map[string]any{"action": "50ms"}})
+			defer c.Close(context.Background())
+
+			err := c.ping(context.Background())
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
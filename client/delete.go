@@ -6,8 +6,11 @@ import (
 
 	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
 	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
 )
 
 const (
@@ -17,38 +20,145 @@ const (
 
 func (c *Client) DeleteStale(ctx context.Context, msg *message.WriteDeleteStale) error {
 	table := msg.GetTable()
+	if !c.includeTable(table.Name) {
+		c.logger.Debug().Str("tableName", table.Name).Msg("table is excluded, skipping delete stale")
+		return nil
+	}
+	if err := c.deletes.flush(ctx, table.Name); err != nil {
+		return fmt.Errorf("failed to flush delete records: %w", err)
+	}
+	if len(c.spec.WriteMode) > 0 && c.spec.WriteMode != spec.WriteModeOverwriteDeleteStale {
+		c.logger.Warn().Str("tableName", table.Name).Str("writeMode", c.spec.WriteMode).Msg("skipping delete stale")
+		return nil
+	}
 	c.logger.Debug().Str("tableName", table.Name).Str("sourceName", msg.SourceName).Time("syncTime", msg.SyncTime).Msg("delete stale")
+	if c.dryRun != nil {
+		c.dryRun.deleteStale(msg)
+		return nil
+	}
 	data, err := proto.Marshal(&pb.Write_MessageDeleteStale{
 		SourceName: msg.SourceName,
 		SyncTime:   timestamppb.New(msg.SyncTime),
-		TableName:  msg.TableName,
+		TableName:  c.namer.tableName(msg.TableName),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal: %w", err)
 	}
-	var body []byte
-	if body, err = c.doAction(ctx, deleteStale, data); err != nil {
-		return fmt.Errorf("failed to doAction: %w", err)
+	affectedRows, err := c.doTableAction(ctx, deleteStale, c.namer.tableName(table.Name), data)
+	if err != nil {
+		return err
 	}
-	c.logger.Debug().Str("body", string(body)).Msg("delete stale result")
+	c.logger.Debug().Str("tableName", table.Name).Int64("affectedRows", affectedRows).Msg("deleted stale records")
 	return nil
 }
 
 func (c *Client) DeleteRecord(ctx context.Context, msg *message.WriteDeleteRecord) error {
 	table := msg.GetTable()
+	if !c.includeTable(table.Name) {
+		c.logger.Debug().Str("tableName", table.Name).Msg("table is excluded, skipping delete records")
+		return nil
+	}
 	c.logger.Debug().Str("tableName", table.Name).Msg("delete records")
+	if len(c.masks) > 0 {
+		masked, err := c.maskDeleteRecord(table.Name, msg)
+		if err != nil {
+			return err
+		}
+		defer releasePredicateRecords(masked)
+		msg = masked
+	}
+	if c.dryRun != nil {
+		return c.dryRun.deleteRecord(msg)
+	}
+	deleteMsg, err := c.deleteRecordMessage(table, msg)
+	if err != nil {
+		return err
+	}
+	if c.deletes != nil {
+		return c.deletes.add(ctx, table.Name, deleteMsg)
+	}
+	data, err := proto.Marshal(deleteMsg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	affectedRows, err := c.doTableAction(ctx, deleteRecord, deleteMsg.TableName, data)
+	if err != nil {
+		return err
+	}
+	c.logger.Debug().Str("tableName", table.Name).Int64("affectedRows", affectedRows).Msg("deleted records")
+	return nil
+}
+
+// maskDeleteRecord returns the DeleteRecord message with the values of the masked columns in the predicate records,
+// which must be released with releasePredicateRecords. Predicates on columns masked by transforms other than
+// `sha256` and `hmac` are rejected, as they would match other stored values or none at all.
+func (c *Client) maskDeleteRecord(tableName string, msg *message.WriteDeleteRecord) (_ *message.WriteDeleteRecord, err error) {
+	masked := &message.WriteDeleteRecord{DeleteRecord: msg.DeleteRecord}
+	masked.WhereClause = make(message.PredicateGroups, len(msg.WhereClause))
+	defer func() {
+		if err != nil {
+			releasePredicateRecords(masked)
+		}
+	}()
+	for i, predicateGroup := range msg.WhereClause {
+		masked.WhereClause[i].GroupingType = predicateGroup.GroupingType
+		for _, predicate := range predicateGroup.Predicates {
+			for _, i := range predicate.Record.Schema().FieldIndices(predicate.Column) {
+				m, err := c.columnMask(tableName, schema.NewColumnFromArrowField(predicate.Record.Schema().Field(i)))
+				if err != nil {
+					return nil, err
+				}
+				if m != nil && !m.hashes() {
+					return nil, fmt.Errorf("can't delete records of table %s by the column %s masked by the %s transform", tableName, predicate.Column, m.Type)
+				}
+			}
+			rec, err := c.maskPredicateRecord(tableName, predicate.Record)
+			if err != nil {
+				return nil, err
+			}
+			masked.WhereClause[i].Predicates = append(masked.WhereClause[i].Predicates, message.Predicate{
+				Operator: predicate.Operator,
+				Column:   predicate.Column,
+				Record:   rec,
+			})
+		}
+	}
+	return masked, nil
+}
+
+func releasePredicateRecords(msg *message.WriteDeleteRecord) {
+	for _, predicateGroup := range msg.WhereClause {
+		for _, predicate := range predicateGroup.Predicates {
+			predicate.Record.Release()
+		}
+	}
+}
+
+// deleteRecordMessage returns the DeleteRecord message as it is sent to the ArrowFlight service, with the converted
+// predicate records and the renamed tables and columns.
+func (c *Client) deleteRecordMessage(table *schema.Table, msg *message.WriteDeleteRecord) (*pb.Write_MessageDeleteRecord, error) {
 	whereClause := make([]*pb.PredicatesGroup, len(msg.WhereClause))
 	for i, predicateGroup := range msg.WhereClause {
 		var predicates []*pb.Predicate
 		for _, predicate := range predicateGroup.Predicates {
-			record, err := pb.RecordToBytes(predicate.Record)
+			converted, err := c.convertRecord(table.Name, predicate.Record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert predicate record: %w", err)
+			}
+			renamed, err := c.namer.record(table.Name, converted)
+			converted.Release()
 			if err != nil {
-				return fmt.Errorf("failed to convert record to bytes: %w", err)
+				return nil, fmt.Errorf("failed to rename predicate record: %w", err)
+			}
+			record, err := pb.RecordToBytes(renamed)
+			renamed.Release()
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert record to bytes: %w", err)
 			}
 			operator := pb.Predicate_Operator(pb.Predicate_Operator_value[predicate.Operator])
 			predicates = append(predicates, &pb.Predicate{
 				Operator: operator,
-				Column:   predicate.Column,
+				Column:   c.namer.columnName(table.Name, predicate.Column),
 				Record:   record,
 			})
 		}
@@ -61,22 +171,13 @@ func (c *Client) DeleteRecord(ctx context.Context, msg *message.WriteDeleteRecor
 	tableRelations := make([]*pb.TableRelation, len(msg.TableRelations))
 	for i, tableRelation := range msg.TableRelations {
 		tableRelations[i] = &pb.TableRelation{
-			TableName:   tableRelation.TableName,
-			ParentTable: tableRelation.ParentTable,
+			TableName:   c.namer.tableName(tableRelation.TableName),
+			ParentTable: c.namer.tableName(tableRelation.ParentTable),
 		}
 	}
-	data, err := proto.Marshal(&pb.Write_MessageDeleteRecord{
-		TableName:      table.Name,
+	return &pb.Write_MessageDeleteRecord{
+		TableName:      c.namer.tableName(table.Name),
 		WhereClause:    whereClause,
 		TableRelations: tableRelations,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to marshal: %w", err)
-	}
-	var body []byte
-	if body, err = c.doAction(ctx, deleteRecord, data); err != nil {
-		return fmt.Errorf("failed to doAction: %w", err)
-	}
-	c.logger.Debug().Str("body", string(body)).Msg("delete records result")
-	return nil
+	}, nil
 }
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+const (
+	deleteRecordBatch = "DeleteRecordBatch"
+)
+
+// deleteBatcher buffers the DeleteRecord messages of each table until they are sent in a single DeleteRecordBatch action,
+// whose body is a stream of size-delimited Write_MessageDeleteRecord messages. A nil deleteBatcher doesn't buffer anything.
+type deleteBatcher struct {
+	client *Client
+	size   int
+	mutex  sync.Mutex
+	tables map[string][]*pb.Write_MessageDeleteRecord
+}
+
+func newDeleteBatcher(c *Client) *deleteBatcher {
+	if c.spec.DeleteRecordBatchSize <= 1 {
+		return nil
+	}
+	return &deleteBatcher{
+		client: c,
+		size:   c.spec.DeleteRecordBatchSize,
+		tables: make(map[string][]*pb.Write_MessageDeleteRecord),
+	}
+}
+
+// add buffers the message of the table, sending the buffered messages of the table once `delete_record_batch_size` is reached.
+func (b *deleteBatcher) add(ctx context.Context, tableName string, msg *pb.Write_MessageDeleteRecord) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tables[tableName] = append(b.tables[tableName], msg)
+	if len(b.tables[tableName]) < b.size {
+		return nil
+	}
+	return b.send(ctx, tableName)
+}
+
+// flush sends the buffered messages of the table. It is called before any other message of the table is written,
+// so the deletes keep their order relative to the inserts.
+func (b *deleteBatcher) flush(ctx context.Context, tableName string) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.send(ctx, tableName)
+}
+
+// flushAll sends the buffered messages of every table.
+func (b *deleteBatcher) flushAll(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	tableNames := make([]string, 0, len(b.tables))
+	for tableName := range b.tables {
+		tableNames = append(tableNames, tableName)
+	}
+	slices.Sort(tableNames)
+	for _, tableName := range tableNames {
+		if err := b.send(ctx, tableName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard drops the buffered messages, as they must not be sent once the sync failed.
+func (b *deleteBatcher) discard() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for tableName, messages := range b.tables {
+		b.client.logger.Warn().Str("tableName", tableName).Int("messages", len(messages)).Msg("discarding buffered delete records")
+	}
+	clear(b.tables)
+}
+
+// send sends the buffered messages of the table. The mutex must be held.
+func (b *deleteBatcher) send(ctx context.Context, tableName string) error {
+	messages := b.tables[tableName]
+	if len(messages) == 0 {
+		return nil
+	}
+	delete(b.tables, tableName)
+
+	var data bytes.Buffer
+	for _, msg := range messages {
+		if _, err := protodelim.MarshalTo(&data, msg); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	}
+	b.client.logger.Debug().Str("tableName", tableName).Int("messages", len(messages)).Msg("delete record batch")
+	affectedRows, err := b.client.doTableAction(ctx, deleteRecordBatch, messages[0].TableName, data.Bytes())
+	if err != nil {
+		return err
+	}
+	b.client.logger.Debug().Str("tableName", tableName).Int64("affectedRows", affectedRows).Msg("deleted record batch")
+	return nil
+}
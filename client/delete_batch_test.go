@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// deleteRecordBatches returns the table names of the messages of every DeleteRecordBatch action received, in order.
+func (s *testFlightServer) deleteRecordBatches(t *testing.T) [][]string {
+	t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var batches [][]string
+	for _, action := range s.actions {
+		if action.GetType() != deleteRecordBatch {
+			continue
+		}
+		var tableNames []string
+		reader := bytes.NewReader(action.GetBody())
+		for {
+			var msg pb.Write_MessageDeleteRecord
+			err := protodelim.UnmarshalFrom(reader, &msg)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			tableNames = append(tableNames, msg.TableName)
+		}
+		batches = append(batches, tableNames)
+	}
+	return batches
+}
+
+func testDeleteRecord(tableName string) *message.WriteDeleteRecord {
+	return &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{TableName: tableName}}
+}
+
+func TestClient_DeleteRecordBatch(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"delete_record_batch_size": 3})
+	ctx := context.Background()
+
+	first, second := testTable("test_delete_batch_first"), testTable("test_delete_batch_second")
+	rec := testRecord(memory.DefaultAllocator, first, 1)
+	defer rec.Release()
+
+	res := make(chan message.WriteMessage, 20)
+	res <- &message.WriteMigrateTable{Table: first}
+	res <- testDeleteRecord(first.Name)
+	res <- testDeleteRecord(second.Name)
+	res <- testDeleteRecord(first.Name)
+	// The insert sends the buffered deletes of its table first.
+	res <- &message.WriteInsert{Record: rec}
+	for i := 0; i < 4; i++ {
+		res <- testDeleteRecord(first.Name)
+	}
+	close(res)
+	require.NoError(t, c.Write(ctx, res))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, 0, countActions(server.actionTypes(), deleteRecord))
+	assert.Equal(t, [][]string{
+		{first.Name, first.Name},
+		{first.Name, first.Name, first.Name},
+		{first.Name},
+		{second.Name},
+	}, server.deleteRecordBatches(t))
+}
+
+func TestClient_DeleteRecordBatchInterval(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"delete_record_batch_size":     100,
+		"delete_record_batch_interval": "50ms",
+	})
+	ctx := context.Background()
+
+	res := make(chan message.WriteMessage)
+	done := make(chan error)
+	go func() {
+		done <- c.Write(ctx, res)
+	}()
+	res <- testDeleteRecord("test_delete_batch_interval")
+	res <- testDeleteRecord("test_delete_batch_interval")
+	assert.Eventually(t, func() bool {
+		return len(server.deleteRecordBatches(t)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	close(res)
+	require.NoError(t, <-done)
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, [][]string{{"test_delete_batch_interval", "test_delete_batch_interval"}}, server.deleteRecordBatches(t))
+}
+
+func TestClient_DeleteRecordBatchDiscarded(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"delete_record_batch_size": 3})
+	ctx := context.Background()
+
+	res := make(chan message.WriteMessage, 2)
+	res <- testDeleteRecord("test_delete_batch_discarded")
+	res <- &unknownWriteMessage{}
+	close(res)
+	require.Error(t, c.Write(ctx, res))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Empty(t, server.deleteRecordBatches(t))
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // registers the client side health check used by healthCheckConfig
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+const (
+	// resolverScheme is the scheme of the resolver serving the addresses listed in `addr`.
+	resolverScheme = "arrowflight"
+	// failoverRetryDelay replaces the write timeout between write attempts when another address can take over.
+	failoverRetryDelay = time.Second
+	// defaultMinConnectTimeout is the gRPC default of the timeout of each attempt to connect to an address.
+	defaultMinConnectTimeout = 20 * time.Second
+)
+
+// serviceConfig is the gRPC service config selecting the load balancing policy and health checks.
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	HealthCheckConfig   *healthCheckConfig    `json:"healthCheckConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// newFlightClient creates a flight client for the addresses of the spec, failing over between them
+// according to the load balancing policy.
+func newFlightClient(ctx context.Context, s spec.Spec) (flight.Client, error) {
+	var transportCredentials credentials.TransportCredentials
+	if s.TlsEnabled {
+		transportCredentials = credentials.NewTLS(&tls.Config{
+			ServerName:         s.TlsServerName,
+			InsecureSkipVerify: s.TlsInsecureSkipVerify,
+		})
+	} else {
+		transportCredentials = insecure.NewCredentials()
+	}
+
+	config := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{s.LoadBalancingPolicy: {}}},
+	}
+	if s.HealthCheck {
+		config.HealthCheckConfig = &healthCheckConfig{}
+	}
+	serviceConfigJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal service config: %w", err)
+	}
+
+	grpcDialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(s.MaxCallRecvMsgSize),
+			grpc.MaxCallSendMsgSize(s.MaxCallSendMsgSize),
+		),
+		grpc.WithDefaultServiceConfig(string(serviceConfigJSON)),
+		grpc.WithChainUnaryInterceptor(traceUnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(traceStreamClientInterceptor),
+		grpc.WithConnectParams(connectParams(s)),
+	}
+	if s.Keepalive.Time.Duration() > 0 {
+		grpcDialOptions = append(grpcDialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                s.Keepalive.Time.Duration(),
+			Timeout:             s.Keepalive.Timeout.Duration(),
+			PermitWithoutStream: s.Keepalive.PermitWithoutStream,
+		}))
+	}
+	if timeout := s.IdleTimeout.Duration(); timeout > 0 {
+		grpcDialOptions = append(grpcDialOptions, grpc.WithIdleTimeout(timeout))
+	}
+
+	target := s.Addr
+	if addrs := s.Addrs(); len(addrs) > 1 {
+		r := manual.NewBuilderWithScheme(resolverScheme)
+		r.InitialState(resolver.State{Addresses: resolverAddresses(addrs)})
+		target = r.Scheme() + ":///" + addrs[0]
+		grpcDialOptions = append(grpcDialOptions, grpc.WithResolvers(r))
+	}
+
+	var flightClient flight.Client
+	if flightClient, err = flight.NewClientWithMiddlewareCtx(ctx, target, newAuthHandler(s.Handshake, s.Token), nil, grpcDialOptions...); err != nil {
+		return nil, fmt.Errorf("failed to create flight client: %w", err)
+	}
+	return flightClient, nil
+}
+
+// connectParams returns the backoff between attempts to connect to an address and the timeout of each attempt.
+// Unset values keep the gRPC defaults.
+func connectParams(s spec.Spec) grpc.ConnectParams {
+	params := grpc.ConnectParams{
+		Backoff:           backoff.DefaultConfig,
+		MinConnectTimeout: defaultMinConnectTimeout,
+	}
+	if timeout := s.Timeouts.Connect.Duration(); timeout > 0 {
+		params.MinConnectTimeout = timeout
+	}
+	if delay := s.Backoff.BaseDelay.Duration(); delay > 0 {
+		params.Backoff.BaseDelay = delay
+	}
+	if s.Backoff.Multiplier > 0 {
+		params.Backoff.Multiplier = s.Backoff.Multiplier
+	}
+	if s.Backoff.Jitter > 0 {
+		params.Backoff.Jitter = s.Backoff.Jitter
+	}
+	if delay := s.Backoff.MaxDelay.Duration(); delay > 0 {
+		params.Backoff.MaxDelay = delay
+	}
+	return params
+}
+
+// resolverAddresses returns the resolver addresses, verifying TLS certificates against the host of each address.
+func resolverAddresses(addrs []string) []resolver.Address {
+	addresses := make([]resolver.Address, len(addrs))
+	for i, addr := range addrs {
+		addresses[i] = resolver.Address{Addr: addr}
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addresses[i].ServerName = host
+		}
+	}
+	return addresses
+}
+
+// failover reports whether calls can fail over to another address, either listed in `addr` or resolved from a gRPC target.
+func failover(s spec.Spec) bool {
+	return len(s.Addrs()) > 1 || strings.Contains(s.Addr, ":///")
+}
+
+// retryDelay returns how long to wait before reconnecting a writer. Without failover the writer waits for the
+// only address to come back, otherwise the balancer already routes the new stream to a healthy address.
+func (c *Client) retryDelay(attempt int) time.Duration {
+	if failover(c.spec) {
+		return time.Duration(attempt) * failoverRetryDelay
+	}
+	return time.Duration(attempt) * writeTimeout
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/cloudquery/plugin-sdk/v4/configtype"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// newTestHealthFlightServer starts an in-process flight server reporting the given health status.
+func newTestHealthFlightServer(t *testing.T, svc flight.FlightServer, servingStatus healthpb.HealthCheckResponse_ServingStatus) string {
+	t.Helper()
+
+	server := flight.NewServerWithMiddleware(nil)
+	require.NoError(t, server.Init("localhost:0"))
+	server.RegisterFlightService(svc)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", servingStatus)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve()
+	}()
+	t.Cleanup(server.Shutdown)
+
+	return server.Addr().String()
+}
+
+// unusedAddr returns an address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return addr
+}
+
+func TestClient_FailoverPickFirst(t *testing.T) {
+	server := newTestFlightService()
+	c := newTestClient(t, unusedAddr(t)+", "+newTestFlightServer(t, server), nil)
+	ctx := context.Background()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: testTable("test_failover")}))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Contains(t, server.actionTypes(), migrateTable)
+}
+
+func TestClient_FailoverRoundRobin(t *testing.T) {
+	first, second := newTestFlightService(), newTestFlightService()
+	addr := strings.Join([]string{newTestFlightServer(t, first), newTestFlightServer(t, second)}, ",")
+	c := newTestClient(t, addr, map[string]any{"load_balancing_policy": "round_robin"})
+	ctx := context.Background()
+
+	// The second address may not be connected yet, so send actions until both received one.
+	for i := 0; i < 100 && (len(first.actionTypes()) == 0 || len(second.actionTypes()) == 0); i++ {
+		_, err := c.doAction(ctx, "Test", "", nil)
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.Close(ctx))
+
+	assert.NotEmpty(t, first.actionTypes())
+	assert.NotEmpty(t, second.actionTypes())
+}
+
+func TestClient_FailoverHealthCheck(t *testing.T) {
+	unhealthy, healthy := newTestFlightService(), newTestFlightService()
+	addr := strings.Join([]string{
+		newTestHealthFlightServer(t, unhealthy, healthpb.HealthCheckResponse_NOT_SERVING),
+		newTestHealthFlightServer(t, healthy, healthpb.HealthCheckResponse_SERVING),
+	}, ",")
+	c := newTestClient(t, addr, map[string]any{"load_balancing_policy": "round_robin", "health_check": true})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: testTable("test_health_check")}))
+	}
+	require.NoError(t, c.Close(ctx))
+
+	assert.Empty(t, unhealthy.actionTypes())
+	assert.Len(t, healthy.actionTypes(), 10)
+}
+
+func TestFailover(t *testing.T) {
+	assert.False(t, failover(spec.Spec{Addr: "localhost:9090"}))
+	assert.True(t, failover(spec.Spec{Addr: "localhost:9090,localhost:9091"}))
+	assert.True(t, failover(spec.Spec{Addr: "dns:///flight.example.com:9090"}))
+}
+
+func TestClient_ConnectionSettings(t *testing.T) {
+	server := newTestFlightService()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"keepalive":    map[string]any{"time": "10s", "timeout": "5s", "permit_without_stream": true},
+		"idle_timeout": "100ms",
+		"backoff":      map[string]any{"base_delay": "100ms", "max_delay": "1s"},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: testTable("test_connection_settings")}))
+	// The idle connection is closed and reestablished by the next call.
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: testTable("test_connection_settings")}))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, 2, countActions(server.actionTypes(), migrateTable))
+}
+
+func TestConnectParams(t *testing.T) {
+	assert.Equal(t, grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: defaultMinConnectTimeout}, connectParams(spec.Spec{}))
+	assert.Equal(t, grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  100 * time.Millisecond,
+			Multiplier: 2,
+			Jitter:     backoff.DefaultConfig.Jitter,
+			MaxDelay:   10 * time.Second,
+		},
+		MinConnectTimeout: 5 * time.Second,
+	}, connectParams(spec.Spec{
+		Timeouts: spec.Timeouts{Connect: configtype.NewDuration(5 * time.Second)},
+		Backoff: spec.Backoff{
+			BaseDelay:  configtype.NewDuration(100 * time.Millisecond),
+			Multiplier: 2,
+			MaxDelay:   configtype.NewDuration(10 * time.Second),
+		},
+	}))
+}
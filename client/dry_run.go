@@ -0,0 +1,201 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/rs/zerolog"
+)
+
+// dryRun records what would be sent to the server instead of sending it. A nil dryRun means the client writes for real.
+type dryRun struct {
+	allocator *trackingAllocator
+	logger    zerolog.Logger
+	mutex     sync.Mutex
+	outputDir string
+	tables    map[string]*dryRunTable
+}
+
+// dryRunTable is the summary of the messages received for a single table.
+type dryRunTable struct {
+	migrated      bool
+	changes       int
+	unsafeChanges int
+	rows          int64
+	bytes         int64
+	deleteStale   int
+	deleteRecord  int
+	file          *os.File
+	writer        *ipc.FileWriter
+}
+
+// dryRunPredicate is the decoded form of a DeleteRecord predicate.
+type dryRunPredicate struct {
+	Operator string          `json:"operator"`
+	Column   string          `json:"column"`
+	Values   json.RawMessage `json:"values"`
+}
+
+// dryRunPredicateGroup is the decoded form of a DeleteRecord predicate group.
+type dryRunPredicateGroup struct {
+	GroupingType string            `json:"grouping_type"`
+	Predicates   []dryRunPredicate `json:"predicates"`
+}
+
+func newDryRun(logger zerolog.Logger, allocator *trackingAllocator, outputDir string) (*dryRun, error) {
+	if len(outputDir) > 0 {
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create dry run output directory: %w", err)
+		}
+	}
+	return &dryRun{
+		allocator: allocator,
+		logger:    logger.With().Bool("dryRun", true).Logger(),
+		outputDir: outputDir,
+		tables:    make(map[string]*dryRunTable),
+	}, nil
+}
+
+// table returns the summary of the table, creating it if needed. The mutex must be held.
+func (d *dryRun) table(tableName string) *dryRunTable {
+	table, ok := d.tables[tableName]
+	if !ok {
+		table = &dryRunTable{}
+		d.tables[tableName] = table
+	}
+	return table
+}
+
+func (d *dryRun) migrateTable(tableName string, migrateForce bool, definition, changes string, changeCount, unsafeCount int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	table := d.table(tableName)
+	table.migrated = true
+	table.changes += changeCount
+	table.unsafeChanges += unsafeCount
+
+	event := d.logger.Info().Str("tableName", tableName).Bool("forceMigrate", migrateForce).RawJSON("definition", []byte(definition))
+	if len(changes) > 0 {
+		event = event.RawJSON("changes", []byte(changes))
+	}
+	event.Msg("dry run: would migrate table")
+}
+
+func (d *dryRun) deleteStale(msg *message.WriteDeleteStale) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.table(msg.TableName).deleteStale++
+	d.logger.Info().Str("tableName", msg.TableName).Str("sourceName", msg.SourceName).Time("syncTime", msg.SyncTime).Msg("dry run: would delete stale records")
+}
+
+func (d *dryRun) deleteRecord(msg *message.WriteDeleteRecord) error {
+	whereClause := make([]dryRunPredicateGroup, len(msg.WhereClause))
+	for i, predicateGroup := range msg.WhereClause {
+		predicates := make([]dryRunPredicate, len(predicateGroup.Predicates))
+		for j, predicate := range predicateGroup.Predicates {
+			values, err := json.Marshal(predicate.Record)
+			if err != nil {
+				return fmt.Errorf("failed to marshal predicate record: %w", err)
+			}
+			predicates[j] = dryRunPredicate{
+				Operator: predicate.Operator,
+				Column:   predicate.Column,
+				Values:   values,
+			}
+		}
+		whereClause[i] = dryRunPredicateGroup{
+			GroupingType: predicateGroup.GroupingType,
+			Predicates:   predicates,
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.table(msg.TableName).deleteRecord++
+	d.logger.Info().Str("tableName", msg.TableName).Interface("whereClause", whereClause).Interface("tableRelations", msg.TableRelations).Msg("dry run: would delete records")
+	return nil
+}
+
+// insert counts the record and appends it to the table's Arrow IPC file if an output directory is set.
+func (d *dryRun) insert(tableName string, rec arrow.Record, size int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	table := d.table(tableName)
+	table.rows += rec.NumRows()
+	table.bytes += int64(size)
+
+	if len(d.outputDir) == 0 {
+		return nil
+	}
+	if table.writer == nil {
+		file, err := os.Create(filepath.Join(d.outputDir, tableName+".arrow"))
+		if err != nil {
+			return fmt.Errorf("failed to create dry run output file: %w", err)
+		}
+		if table.writer, err = ipc.NewFileWriter(file, ipc.WithSchema(rec.Schema()), ipc.WithAllocator(d.allocator)); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to create dry run output writer: %w", err)
+		}
+		table.file = file
+	}
+	if err := table.writer.Write(rec); err != nil {
+		return fmt.Errorf("failed to write dry run output: %w", err)
+	}
+	return nil
+}
+
+// close closes the output files and logs the summary of every table.
+func (d *dryRun) close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tableNames := make([]string, 0, len(d.tables))
+	for tableName := range d.tables {
+		tableNames = append(tableNames, tableName)
+	}
+	slices.Sort(tableNames)
+
+	var (
+		errs  []error
+		rows  int64
+		bytes int64
+	)
+	for _, tableName := range tableNames {
+		table := d.tables[tableName]
+		if table.writer != nil {
+			errs = append(errs, table.writer.Close(), table.file.Close())
+			table.writer, table.file = nil, nil
+		}
+		rows += table.rows
+		bytes += table.bytes
+		d.logger.Info().
+			Str("tableName", tableName).
+			Bool("migrated", table.migrated).
+			Int("changes", table.changes).
+			Int("unsafeChanges", table.unsafeChanges).
+			Int64("rows", table.rows).
+			Int64("bytes", table.bytes).
+			Int("deleteStale", table.deleteStale).
+			Int("deleteRecord", table.deleteRecord).
+			Msg("dry run: table summary")
+	}
+	d.logger.Info().Int("tables", len(tableNames)).Int64("rows", rows).Int64("bytes", bytes).Str("outputDir", d.outputDir).Msg("dry run: summary")
+	clear(d.tables)
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to close dry run output files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_DryRun(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	outputDir := filepath.Join(t.TempDir(), "dry_run")
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"dry_run":            true,
+		"dry_run_output_dir": outputDir,
+		"transactional":      true,
+		"write_mode":         "overwrite-delete-stale",
+	})
+	ctx := context.Background()
+
+	table := testTable("test_dry_run")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+
+	res := make(chan message.WriteMessage, 5)
+	res <- &message.WriteMigrateTable{Table: table}
+	res <- &message.WriteInsert{Record: rec}
+	res <- &message.WriteInsert{Record: rec}
+	res <- &message.WriteDeleteStale{TableName: table.Name, SourceName: "test", SyncTime: time.Now()}
+	res <- &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{TableName: table.Name}}
+	close(res)
+
+	require.NoError(t, c.Write(ctx, res))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, []string{getCapabilities}, server.actionTypes())
+	assert.Zero(t, server.rows(table.Name))
+
+	f, err := os.Open(filepath.Join(outputDir, table.Name+".arrow"))
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := ipc.NewFileReader(f)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, 2, reader.NumRecords())
+	for i := 0; i < reader.NumRecords(); i++ {
+		got, err := reader.Record(i)
+		require.NoError(t, err)
+		assert.Equal(t, rec.NumRows(), got.NumRows())
+	}
+}
+
+func TestClient_DryRunTargets(t *testing.T) {
+	primary, secondary := newTestFlightService(), newTestFlightService()
+	defer primary.release()
+	defer secondary.release()
+	outputDir := t.TempDir()
+	c := newTestClient(t, "", map[string]any{
+		"dry_run":            true,
+		"dry_run_output_dir": outputDir,
+		"targets": []map[string]any{
+			{"name": "primary", "addr": newTestFlightServer(t, primary)},
+			{"name": "secondary", "addr": newTestFlightServer(t, secondary)},
+		},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_dry_run_targets")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+
+	res := make(chan message.WriteMessage, 2)
+	res <- &message.WriteMigrateTable{Table: table}
+	res <- &message.WriteInsert{Record: rec}
+	close(res)
+
+	require.NoError(t, c.Write(ctx, res))
+	require.NoError(t, c.Close(ctx))
+
+	for _, target := range []string{"primary", "secondary"} {
+		f, err := os.Open(filepath.Join(outputDir, target, table.Name+".arrow"))
+		require.NoError(t, err)
+		reader, err := ipc.NewFileReader(f)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reader.NumRecords(), target)
+		require.NoError(t, reader.Close())
+		require.NoError(t, f.Close())
+	}
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	exchangeStatusAck    = "ack"
+	exchangeStatusReject = "reject"
+)
+
+// errExchangeStreamEnded is returned by push if the stream ended while the window was full.
+// The unacknowledged batches must be resent on a new stream to free the window.
+var errExchangeStreamEnded = errors.New("do exchange stream ended with a full window")
+
+// exchangeMetadata is attached as app metadata to every batch sent over DoExchange.
+type exchangeMetadata struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+// exchangeAck is sent back by the server as app metadata for every batch received over DoExchange.
+type exchangeAck struct {
+	Sequence uint64 `json:"sequence"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+}
+
+// exchangeWindow keeps the batches which were sent but not yet acknowledged by the server.
+// The retained batches are accounted in the allocator.
+type exchangeWindow struct {
+	allocator *trackingAllocator
+	mutex     sync.Mutex
+	changed   chan struct{}
+	err       error
+	pending   []recordBatch
+	sequence  uint64
+	size      int
+}
+
+func newExchangeWindow(size int, allocator *trackingAllocator) *exchangeWindow {
+	return &exchangeWindow{
+		allocator: allocator,
+		changed:   make(chan struct{}),
+		size:      size,
+	}
+}
+
+// push waits for a free slot in the window and adds the record to it. The size of the record must be reserved
+// in the allocator, the window unreserves it once the record is acknowledged or released.
+// It fails with errExchangeStreamEnded if the done channel of the stream is closed while waiting.
+func (w *exchangeWindow) push(ctx context.Context, rec arrow.Record, size int64, done <-chan struct{}) (uint64, error) {
+	for {
+		w.mutex.Lock()
+		if w.err != nil {
+			w.mutex.Unlock()
+			return 0, w.err
+		}
+		if len(w.pending) < w.size {
+			w.sequence++
+			rec.Retain()
+			w.pending = append(w.pending, recordBatch{sequence: w.sequence, size: size, record: rec})
+			sequence := w.sequence
+			w.mutex.Unlock()
+			return sequence, nil
+		}
+		changed := w.changed
+		w.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-done:
+			return 0, errExchangeStreamEnded
+		case <-changed:
+		}
+	}
+}
+
+// ack removes the batch from the window and returns its size.
+func (w *exchangeWindow) ack(sequence uint64) (int64, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, batch := range w.pending {
+		if batch.sequence != sequence {
+			continue
+		}
+		batch.record.Release()
+		w.allocator.unreserve(batch.size)
+		w.pending = append(w.pending[:i], w.pending[i+1:]...)
+		w.notify()
+		return batch.size, true
+	}
+	return 0, false
+}
+
+func (w *exchangeWindow) reject(sequence uint64, message string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err == nil {
+		w.err = fmt.Errorf("server rejected batch %d: %s", sequence, message)
+	}
+	w.notify()
+}
+
+// unacked returns the pending batches sent before the given sequence, in order.
+// The records are retained and must be released by the caller.
+func (w *exchangeWindow) unacked(before uint64) []recordBatch {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var batches []recordBatch
+	for _, batch := range w.pending {
+		if batch.sequence < before {
+			batch.record.Retain()
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+// drain waits until every pending batch was acknowledged or the done channel is closed.
+func (w *exchangeWindow) drain(ctx context.Context, done <-chan struct{}) error {
+	for {
+		w.mutex.Lock()
+		if w.err != nil {
+			w.mutex.Unlock()
+			return w.err
+		}
+		pending := len(w.pending)
+		changed := w.changed
+		w.mutex.Unlock()
+
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d batches were not acknowledged: %w", pending, ctx.Err())
+		case <-done:
+			return fmt.Errorf("%d batches were not acknowledged before the stream ended", pending)
+		case <-changed:
+		}
+	}
+}
+
+// release empties the window and returns the number of batches and bytes it held.
+func (w *exchangeWindow) release() (int, int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var size int64
+	for _, batch := range w.pending {
+		batch.record.Release()
+		size += batch.size
+	}
+	batches := len(w.pending)
+	w.allocator.unreserve(size)
+	w.pending = nil
+	w.notify()
+	return batches, size
+}
+
+// notify wakes up everyone waiting for the window to change. The mutex must be held.
+func (w *exchangeWindow) notify() {
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+func (w *Writer) doExchangeAcks(ctx context.Context, stream flight.FlightService_DoExchangeClient, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.client.logger.Debug().Msg("stopping ack processing")
+			return
+		default:
+		}
+
+		flightData, err := stream.Recv()
+		code := status.Code(err)
+		if errors.Is(err, io.EOF) || code == codes.Canceled || code == codes.Unavailable {
+			return
+		} else if err != nil {
+			w.client.logger.Error().Err(err).Msg("failed to receive exchange ack")
+			return
+		}
+
+		var ack exchangeAck
+		if err = json.Unmarshal(flightData.GetAppMetadata(), &ack); err != nil {
+			w.client.logger.Warn().Err(err).Str("appMetadata", string(flightData.GetAppMetadata())).Msg("failed to decode exchange ack")
+			continue
+		}
+
+		switch ack.Status {
+		case exchangeStatusAck:
+			size, ok := w.exchange.ack(ack.Sequence)
+			if !ok {
+				w.client.logger.Debug().Str("table", w.tableName).Uint64("sequence", ack.Sequence).Msg("ack for unknown batch")
+				continue
+			}
+			w.releaseInFlight(1, size)
+		case exchangeStatusReject:
+			w.client.logger.Error().Str("table", w.tableName).Uint64("sequence", ack.Sequence).Str("message", ack.Message).Msg("batch rejected")
+			w.exchange.reject(ack.Sequence, ack.Message)
+		default:
+			w.client.logger.Warn().Str("table", w.tableName).Str("status", ack.Status).Msg("unknown exchange ack status")
+		}
+	}
+}
+
+// reconnectExchange opens a new DoExchange stream and resends every batch which was not acknowledged yet.
+func (w *Writer) reconnectExchange(ctx context.Context, rec arrow.Record, attempt int) error {
+	w.cancel()
+	if err := w.client.authenticate(ctx); err != nil {
+		return fmt.Errorf("failed to reauthenticate: %w", err)
+	}
+
+	time.Sleep(w.client.retryDelay(attempt))
+
+	if err := w.init(ctx, rec); err != nil {
+		return fmt.Errorf("failed to reinitialize writer: %w", err)
+	}
+	return w.resendUnacked(math.MaxUint64)
+}
+
+// resendUnacked writes every batch sent before the given sequence which was not acknowledged yet.
+func (w *Writer) resendUnacked(sequence uint64) error {
+	batches := w.exchange.unacked(sequence)
+	defer func() {
+		for _, batch := range batches {
+			batch.record.Release()
+		}
+	}()
+	for _, batch := range batches {
+		w.client.logger.Debug().Str("table", w.tableName).Uint64("sequence", batch.sequence).Msg("resending unacknowledged batch")
+		if err := w.writeBatch(batch); err != nil {
+			return fmt.Errorf("failed to resend batch %d: %w", batch.sequence, err)
+		}
+	}
+	return nil
+}
+
+func marshalExchangeMetadata(sequence uint64) ([]byte, error) {
+	return json.Marshal(exchangeMetadata{Sequence: sequence})
+}
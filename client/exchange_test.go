@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_DoExchange(t *testing.T) {
+	tests := []struct {
+		name      string
+		rejectSeq uint64
+		wantErr   string
+	}{
+		{
+			name: "should acknowledge every batch",
+		},
+		{
+			name:      "should fail on rejected batch",
+			rejectSeq: 2,
+			wantErr:   "server rejected batch 2: invalid batch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			server.rejectSeq = tt.rejectSeq
+			defer server.release()
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+				"write_transport":      "do_exchange",
+				"exchange_window_size": 2,
+			})
+
+			table := testTable("test_exchange")
+			ctx := context.Background()
+			for i := 0; i < 3; i++ {
+				rec := testRecord(memory.DefaultAllocator, table, 10)
+				err := c.Insert(ctx, &message.WriteInsert{Record: rec})
+				rec.Release()
+				if err != nil {
+					require.NotEmpty(t, tt.wantErr)
+					assert.ErrorContains(t, err, tt.wantErr)
+					_ = c.Close(ctx)
+					return
+				}
+			}
+
+			err := c.Close(ctx)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			assert.Equal(t, []uint64{1, 2, 3}, server.sequences)
+		})
+	}
+}
+
+func TestWriter_DoExchangeDroppedStream(t *testing.T) {
+	server := newTestFlightService()
+	server.dropAfter = 2
+	defer server.release()
+	addr := newTestFlightServer(t, server)
+	// Listing the address twice enables failover, which shortens the delay before reconnecting.
+	c := newTestClient(t, addr+","+addr, map[string]any{
+		"write_transport":      "do_exchange",
+		"exchange_window_size": 2,
+	})
+
+	table := testTable("test_exchange_dropped")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		rec := testRecord(memory.DefaultAllocator, table, 10)
+		err := c.Insert(ctx, &message.WriteInsert{Record: rec})
+		rec.Release()
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.Close(ctx))
+
+	// The batches of the dropped stream were never acknowledged, so they are resent on the new stream before the third batch.
+	assert.Equal(t, int64(50), server.rows("test_exchange_dropped"))
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.Equal(t, []uint64{1, 2, 3}, server.sequences)
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+// cqColumnPrefix is the prefix of the columns added by CloudQuery, which are never filtered.
+const cqColumnPrefix = "_cq_"
+
+// filtersColumns reports whether any column filter is set.
+func (c *Client) filtersColumns() bool {
+	return len(c.spec.IncludeColumns) > 0 || len(c.spec.ExcludeColumns) > 0
+}
+
+// includeTable reports whether the table is written to the ArrowFlight service.
+func (c *Client) includeTable(tableName string) bool {
+	return c.spec.IncludeTable(tableName)
+}
+
+// includeColumn reports whether the column of the table is written to the ArrowFlight service.
+// Primary key and CloudQuery columns are always written, as the service needs them to apply the records.
+func (c *Client) includeColumn(tableName string, column schema.Column) bool {
+	if column.PrimaryKey || strings.HasPrefix(column.Name, cqColumnPrefix) {
+		return true
+	}
+	return c.spec.IncludeColumn(tableName, column.Name)
+}
+
+// filterTable returns the table without the filtered columns. The table is returned as is if no column is filtered.
+func (c *Client) filterTable(table *schema.Table) *schema.Table {
+	columns := make(schema.ColumnList, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if c.includeColumn(table.Name, column) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == len(table.Columns) {
+		return table
+	}
+	filtered := table.Copy(nil)
+	filtered.Columns = columns
+	return filtered
+}
+
+// filterRecord returns the record without the columns of the filtered table. The returned record must be released.
+func (c *Client) filterRecord(table *schema.Table, rec arrow.Record) arrow.Record {
+	fields := make([]arrow.Field, 0, rec.NumCols())
+	columns := make([]arrow.Array, 0, rec.NumCols())
+	for i, column := range table.Columns {
+		if c.includeColumn(table.Name, column) {
+			fields = append(fields, rec.Schema().Field(i))
+			columns = append(columns, rec.Column(i))
+		}
+	}
+	if len(columns) == int(rec.NumCols()) {
+		rec.Retain()
+		return rec
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows())
+}
+
+// restoreRecord returns the record read from the ArrowFlight service with the columns of the schema, filling
+// the filtered columns with nulls. The returned record must be released.
+func restoreRecord(mem memory.Allocator, sc *arrow.Schema, rec arrow.Record) arrow.Record {
+	fields := sc.Fields()
+	columns := make([]arrow.Array, len(fields))
+	for i, field := range fields {
+		indices := rec.Schema().FieldIndices(field.Name)
+		if len(indices) == 0 {
+			columns[i] = array.MakeArrayOfNull(mem, field.Type, int(rec.NumRows()))
+			continue
+		}
+		columns[i] = rec.Column(indices[0])
+		columns[i].Retain()
+		// Columns stored with another type, e.g. masked ones, are read as they are stored.
+		if !arrow.TypeEqual(field.Type, columns[i].DataType()) {
+			fields[i] = rec.Schema().Field(indices[0])
+		}
+	}
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	metadata := sc.Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows())
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func TestClient_IncludeColumn(t *testing.T) {
+	c := &Client{spec: spec.Spec{
+		IncludeColumns: []string{"aws_ec2_*.instance_*"},
+		ExcludeColumns: []string{"*.policy_document", "aws_ec2_instances.instance_secret"},
+	}}
+
+	tests := []struct {
+		tableName string
+		column    schema.Column
+		want      bool
+	}{
+		{tableName: "aws_ec2_instances", column: schema.Column{Name: "instance_id"}, want: true},
+		{tableName: "aws_ec2_instances", column: schema.Column{Name: "region"}, want: false},
+		{tableName: "aws_ec2_instances", column: schema.Column{Name: "region", PrimaryKey: true}, want: true},
+		{tableName: "aws_ec2_instances", column: schema.CqSyncTimeColumn, want: true},
+		{tableName: "aws_ec2_instances", column: schema.Column{Name: "instance_secret"}, want: false},
+		{tableName: "aws_iam_policies", column: schema.Column{Name: "region"}, want: true},
+		{tableName: "aws_iam_policies", column: schema.Column{Name: "policy_document"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tableName+"."+tt.column.Name, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.includeColumn(tt.tableName, tt.column))
+		})
+	}
+}
+
+func TestClient_Filters(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"exclude_tables":  []string{"secret_*"},
+		"exclude_columns": []string{"test_filter.name"},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_filter")
+	secret := testTable("secret_keys")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+	secretRec := testRecord(memory.DefaultAllocator, secret, 10)
+	defer secretRec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: secret}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: secretRec}))
+	require.NoError(t, c.DeleteStale(ctx, &message.WriteDeleteStale{TableName: secret.Name, SourceName: "test"}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	assert.Equal(t, 1, countActions(server.actionTypes(), migrateTable))
+	assert.Equal(t, 0, countActions(server.actionTypes(), deleteStale))
+	assert.Equal(t, int64(10), server.rows(table.Name))
+	assert.Equal(t, int64(0), server.rows(secret.Name))
+	assert.Equal(t, 1, server.schemas[table.Name].NumFields())
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	require.NoError(t, c.Read(ctx, secret, res))
+	close(res)
+	var rows int64
+	for r := range res {
+		assert.True(t, r.Schema().Equal(table.ToArrowSchema()))
+		assert.Equal(t, r.NumRows(), int64(r.Column(1).NullN()))
+		rows += r.NumRows()
+		r.Release()
+	}
+	assert.Equal(t, int64(10), rows)
+}
@@ -2,52 +2,134 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/flight"
 	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
 )
 
-func flightDescriptor(tableName string) *flight.FlightDescriptor {
+// descriptorCommand is sent as the command of the flight descriptor of every DoPut stream.
+type descriptorCommand struct {
+	TransactionID string           `json:"transaction_id,omitempty"`
+	SyncContext   *syncContext     `json:"sync_context,omitempty"`
+	Table         *tableDefinition `json:"table,omitempty"`
+}
+
+func (c *Client) flightDescriptor(tableName string) *flight.FlightDescriptor {
 	return &flight.FlightDescriptor{
 		Type: flight.DescriptorPATH,
-		Path: []string{"cloudquery", "arrowflight", tableName},
+		Path: append(slices.Clone(c.spec.DescriptorPath), tableName),
+	}
+}
+
+// putDescriptor returns the flight descriptor for writing the record to the table, carrying the descriptor command.
+func (c *Client) putDescriptor(tableName string, rec arrow.Record) (*flight.FlightDescriptor, error) {
+	table, err := schema.NewTableFromArrowSchema(rec.Schema())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table from schema: %w", err)
+	}
+	writeMode := c.writeMode(table)
+	descriptor := c.flightDescriptor(tableName)
+	if c.namer != nil {
+		// The sync context is read from the CloudQuery columns, which may be renamed.
+		rec = originalNames(rec)
+		defer rec.Release()
+	}
+	cmd := descriptorCommand{
+		TransactionID: c.currentTransactionID(),
+		SyncContext:   newSyncContext(rec, writeMode),
+		Table:         newTableDefinition(table, writeMode),
 	}
+	if descriptor.Cmd, err = json.Marshal(cmd); err != nil {
+		return nil, fmt.Errorf("failed to marshal descriptor command: %w", err)
+	}
+	return descriptor, nil
+}
+
+// doAction sends the action and returns the body of its first result. The table name is only used for tracing
+// and is empty for actions which don't concern a single table.
+func (c *Client) doAction(ctx context.Context, actionType string, tableName string, body []byte) ([]byte, error) {
+	bodies, err := c.doActionResults(ctx, actionType, tableName, body)
+	if err != nil || len(bodies) == 0 {
+		return nil, err
+	}
+	return bodies[0], nil
 }
 
-func (c *Client) doAction(ctx context.Context, actionType string, body []byte) ([]byte, error) {
-	flightDoActionClient, err := c.flightClient.DoAction(ctx, &flight.Action{
+// doActionResults sends the action and returns the bodies of all its results, in the order they were streamed.
+func (c *Client) doActionResults(ctx context.Context, actionType string, tableName string, body []byte) (_ [][]byte, err error) {
+	ctx, span := startSpan(ctx, spanDoAction, attributeAction.String(actionType), attributeTableName.String(tableName), attributeBytes.Int(len(body)))
+	start := time.Now()
+	timeout := c.spec.Timeouts.ActionTimeout(actionType)
+	actionCtx, cancel := withTimeout(ctx, timeout)
+	defer func() {
+		err = timeoutError(ctx, actionCtx, err, actionType, tableName, timeout)
+		cancel()
+		c.metrics.recordAction(ctx, actionType, tableName, time.Since(start), err)
+		endSpan(span, err)
+	}()
+
+	flightDoActionClient, err := c.flightClient.DoAction(actionCtx, &flight.Action{
 		Type: actionType,
 		Body: body,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create doAction client: %w", err)
 	}
-	var result *flight.Result
-	if result, err = flightDoActionClient.Recv(); errors.Is(err, io.EOF) {
-		return nil, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to receive doAction result: %w", err)
+	var bodies [][]byte
+	for {
+		var result *flight.Result
+		if result, err = flightDoActionClient.Recv(); errors.Is(err, io.EOF) {
+			return bodies, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to receive doAction result: %w", err)
+		}
+		bodies = append(bodies, result.GetBody())
 	}
-	return result.GetBody(), nil
 }
 
-func (c *Client) doGet(ctx context.Context, endpoint *flight.FlightEndpoint, schema *arrow.Schema, res chan<- arrow.Record) error {
-	doGetClient, err := c.flightClient.DoGet(ctx, endpoint.GetTicket())
+func (c *Client) doGet(ctx context.Context, tableName string, endpoint *flight.FlightEndpoint, schema *arrow.Schema, restore recordConverter, res chan<- arrow.Record) (err error) {
+	ctx, span := startSpan(ctx, spanDoGet, attributeTableName.String(tableName))
+	var rows, bytes int64
+	start := time.Now()
+	defer func() {
+		c.metrics.recordRead(ctx, tableName, rows, bytes, time.Since(start))
+		span.SetAttributes(attributeRows.Int64(rows), attributeBytes.Int64(bytes))
+		endSpan(span, err)
+	}()
+
+	timeout := c.spec.Timeouts.DoGet.Duration()
+	doGetCtx, cancel := withTimeout(ctx, timeout)
+	defer func() {
+		err = timeoutError(ctx, doGetCtx, err, operationDoGet, tableName, timeout)
+		cancel()
+	}()
+
+	doGetClient, err := c.flightClient.DoGet(doGetCtx, endpoint.GetTicket())
 	if err != nil {
 		return fmt.Errorf("failed to create doPut client: %w", err)
 	}
 	var recordReader *flight.Reader
-	if recordReader, err = flight.NewRecordReader(doGetClient, ipc.WithSchema(schema)); err != nil {
+	if recordReader, err = flight.NewRecordReader(doGetClient, ipc.WithSchema(schema), ipc.WithAllocator(c.allocator)); err != nil {
 		return fmt.Errorf("failed to create record reader: %w", err)
 	}
 	defer recordReader.Release()
 	for recordReader.Next() {
 		r := recordReader.Record()
-		r.Retain()
+		rows += r.NumRows()
+		bytes += int64(estimateRecordSize(r))
+		if restore == nil {
+			r.Retain()
+		} else if r, err = restore(r); err != nil {
+			return fmt.Errorf("failed to restore record: %w", err)
+		}
 		res <- r
 	}
 	if err = recordReader.Err(); err != nil {
@@ -56,10 +138,19 @@ func (c *Client) doGet(ctx context.Context, endpoint *flight.FlightEndpoint, sch
 	return nil
 }
 
-func (c *Client) getFlightInfo(ctx context.Context, tableName string) (*flight.FlightInfo, error) {
-	flightInfo, err := c.flightClient.GetFlightInfo(ctx, flightDescriptor(tableName))
+func (c *Client) getFlightInfo(ctx context.Context, tableName string) (_ *flight.FlightInfo, err error) {
+	ctx, span := startSpan(ctx, spanGetFlightInfo, attributeTableName.String(tableName))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	timeout := c.spec.Timeouts.GetFlightInfo.Duration()
+	getFlightInfoCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	flightInfo, err := c.flightClient.GetFlightInfo(getFlightInfoCtx, c.flightDescriptor(tableName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get flight info: %w", err)
+		return nil, fmt.Errorf("failed to get flight info: %w", timeoutError(ctx, getFlightInfoCtx, err, operationGetFlightInfo, tableName, timeout))
 	}
+	span.SetAttributes(attributeRows.Int64(flightInfo.GetTotalRecords()), attributeBytes.Int64(flightInfo.GetTotalBytes()))
 	return flightInfo, nil
 }
@@ -0,0 +1,404 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/plugin"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// testFlightServer keeps the records put per table in memory and serves them back on DoGet.
+type testFlightServer struct {
+	flight.BaseFlightServer
+
+	mutex   sync.Mutex
+	actions []*flight.Action
+	// actionResults are the result bodies sent for the calls of an action type, one list per call.
+	// The last list is sent for all further calls.
+	actionResults map[string][][]string
+	capabilities  *capabilities
+	descriptors   map[string]*flight.FlightDescriptor
+	// dropAfter ends the next stream with Unavailable after receiving this many batches, without acknowledging any of them.
+	dropAfter  int
+	failAction string
+	headers    []metadata.MD
+	// holdResults delays every PutResult until it is closed.
+	holdResults chan struct{}
+	records     map[string][]arrow.Record
+	rejectSeq   uint64
+	schemas     map[string]*arrow.Schema
+	sequences   []uint64
+	// stall names an action type, or GetFlightInfo, GetSchema or ListActions, which blocks until the call is cancelled.
+	stall string
+	// stallStreams is the number of the next DoPut and DoExchange streams which block without reading until they are cancelled.
+	stallStreams int
+}
+
+func newTestFlightService() *testFlightServer {
+	return &testFlightServer{
+		descriptors: make(map[string]*flight.FlightDescriptor),
+		records:     make(map[string][]arrow.Record),
+		schemas:     make(map[string]*arrow.Schema),
+	}
+}
+
+func (s *testFlightServer) DoAction(action *flight.Action, stream flight.FlightService_DoActionServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+
+	s.mutex.Lock()
+	s.actions = append(s.actions, action)
+	s.headers = append(s.headers, md)
+	results, hasResults := s.actionResults[action.GetType()]
+	if len(results) > 1 {
+		s.actionResults[action.GetType()] = results[1:]
+	}
+	stall := s.stall
+	s.mutex.Unlock()
+
+	if action.GetType() == stall {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	if hasResults && len(results) > 0 {
+		for _, body := range results[0] {
+			if err := stream.Send(&flight.Result{Body: []byte(body)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch action.GetType() {
+	case s.failAction:
+		return status.Errorf(codes.Internal, "failed to %s", action.GetType())
+	case getCapabilities:
+		if s.capabilities == nil {
+			return status.Error(codes.Unimplemented, "unknown action")
+		}
+		b, err := json.Marshal(s.capabilities)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&flight.Result{Body: b})
+	case beginSync:
+		return stream.Send(&flight.Result{Body: []byte("test-transaction")})
+	default:
+		return stream.Send(&flight.Result{Body: []byte("ok")})
+	}
+}
+
+// ListActions fails with Internal if failAction is ListActions, and is otherwise unimplemented.
+func (s *testFlightServer) ListActions(empty *flight.Empty, stream flight.FlightService_ListActionsServer) error {
+	s.mutex.Lock()
+	stall := s.stall
+	s.mutex.Unlock()
+	if stall == operationListActions {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+
+	if s.failAction == operationListActions {
+		return status.Error(codes.Internal, "failed to list actions")
+	}
+	return s.BaseFlightServer.ListActions(empty, stream)
+}
+
+// actionTypes returns the types of the actions received, in order.
+func (s *testFlightServer) actionTypes() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	types := make([]string, len(s.actions))
+	for i, action := range s.actions {
+		types[i] = action.GetType()
+	}
+	return types
+}
+
+// migratedSchema returns the schema of the last MigrateTable action of the table.
+func (s *testFlightServer) migratedSchema(t *testing.T, tableName string) *arrow.Schema {
+	t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := len(s.actions) - 1; i >= 0; i-- {
+		if s.actions[i].GetType() != migrateTable {
+			continue
+		}
+		var msg pb.Write_MessageMigrateTable
+		require.NoError(t, proto.Unmarshal(s.actions[i].GetBody(), &msg))
+		sc, err := flight.DeserializeSchema(msg.Table, memory.DefaultAllocator)
+		require.NoError(t, err)
+		if name, _ := sc.Metadata().GetValue(schema.MetadataTableName); name == tableName {
+			return sc
+		}
+	}
+	t.Fatalf("table %s wasn't migrated", tableName)
+	return nil
+}
+
+func (s *testFlightServer) DoPut(stream flight.FlightService_DoPutServer) error {
+	if s.stallStream() {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+	return s.readRecords(stream, func(*flight.Reader) error {
+		if s.holdResults != nil {
+			select {
+			case <-s.holdResults:
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+		return stream.Send(&flight.PutResult{})
+	})
+}
+
+// DoExchange acknowledges every batch carrying a sequence, except for rejectSeq which is rejected.
+func (s *testFlightServer) DoExchange(stream flight.FlightService_DoExchangeServer) error {
+	if s.stallStream() {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+	return s.readRecords(stream, func(reader *flight.Reader) error {
+		if len(reader.LatestAppMetadata()) == 0 {
+			return nil
+		}
+
+		var metadata exchangeMetadata
+		if err := json.Unmarshal(reader.LatestAppMetadata(), &metadata); err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		s.sequences = append(s.sequences, metadata.Sequence)
+		s.mutex.Unlock()
+
+		ack := exchangeAck{Sequence: metadata.Sequence, Status: exchangeStatusAck}
+		if metadata.Sequence == s.rejectSeq {
+			ack.Status = exchangeStatusReject
+			ack.Message = "invalid batch"
+		}
+		b, err := json.Marshal(ack)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&flight.FlightData{AppMetadata: b})
+	})
+}
+
+// stallStream reports whether the stream should be stalled, counting it against stallStreams.
+func (s *testFlightServer) stallStream() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stallStreams == 0 {
+		return false
+	}
+	s.stallStreams--
+	return true
+}
+
+func (s *testFlightServer) readRecords(stream flight.DataStreamReader, ack func(*flight.Reader) error) error {
+	reader, err := flight.NewRecordReader(stream)
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	path := reader.LatestFlightDescriptor().GetPath()
+	tableName := path[len(path)-1]
+
+	s.mutex.Lock()
+	s.descriptors[tableName] = reader.LatestFlightDescriptor()
+	s.mutex.Unlock()
+
+	s.mutex.Lock()
+	dropAfter := s.dropAfter
+	s.dropAfter = 0
+	s.mutex.Unlock()
+
+	var received int
+	for reader.Next() {
+		rec := reader.Record()
+		rec.Retain()
+
+		s.mutex.Lock()
+		s.schemas[tableName] = rec.Schema()
+		s.records[tableName] = append(s.records[tableName], rec)
+		s.mutex.Unlock()
+
+		if dropAfter > 0 {
+			if rec.NumRows() > 0 {
+				received++
+			}
+			if received == dropAfter {
+				return status.Error(codes.Unavailable, "stream dropped")
+			}
+			continue
+		}
+
+		if err = ack(reader); err != nil {
+			return err
+		}
+	}
+	return reader.Err()
+}
+
+// rows returns the number of rows put for the table.
+func (s *testFlightServer) rows(tableName string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var rows int64
+	for _, rec := range s.records[tableName] {
+		rows += rec.NumRows()
+	}
+	return rows
+}
+
+func (s *testFlightServer) GetFlightInfo(ctx context.Context, descriptor *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	tableName := descriptor.GetPath()[len(descriptor.GetPath())-1]
+
+	s.mutex.Lock()
+	stall := s.stall
+	s.mutex.Unlock()
+	if stall == operationGetFlightInfo {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sc, ok := s.schemas[tableName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s not found", tableName)
+	}
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(sc, memory.DefaultAllocator),
+		FlightDescriptor: descriptor,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: []byte(tableName)}}},
+	}, nil
+}
+
+func (s *testFlightServer) GetSchema(ctx context.Context, descriptor *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	tableName := descriptor.GetPath()[len(descriptor.GetPath())-1]
+
+	s.mutex.Lock()
+	stall := s.stall
+	s.mutex.Unlock()
+	if stall == operationGetSchema {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sc, ok := s.schemas[tableName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s not found", tableName)
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(sc, memory.DefaultAllocator)}, nil
+}
+
+func (s *testFlightServer) DoGet(ticket *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	tableName := string(ticket.GetTicket())
+
+	s.mutex.Lock()
+	records := s.records[tableName]
+	sc := s.schemas[tableName]
+	s.mutex.Unlock()
+
+	writer := flight.NewRecordWriter(stream, ipc.WithSchema(sc))
+	defer writer.Close()
+	for _, rec := range records {
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testFlightServer) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, records := range s.records {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}
+}
+
+// newTestFlightServer starts an in-process flight server and returns its address.
+func newTestFlightServer(t *testing.T, svc flight.FlightServer) string {
+	t.Helper()
+
+	server := flight.NewServerWithMiddleware(nil)
+	require.NoError(t, server.Init("localhost:0"))
+	server.RegisterFlightService(svc)
+	go func() {
+		_ = server.Serve()
+	}()
+	t.Cleanup(server.Shutdown)
+
+	return server.Addr().String()
+}
+
+// newTestClient creates a client connected to addr with the given spec overrides.
+func newTestClient(t *testing.T, addr string, overrides map[string]any) *Client {
+	t.Helper()
+
+	s := map[string]any{"addr": addr}
+	for k, v := range overrides {
+		s[k] = v
+	}
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	c, err := New(context.Background(), zerolog.New(os.Stdout).Level(zerolog.WarnLevel), b, plugin.NewClientOptions{})
+	require.NoError(t, err)
+
+	return c.(*Client)
+}
+
+func testTable(name string) *schema.Table {
+	return &schema.Table{
+		Name: name,
+		Columns: schema.ColumnList{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64, PrimaryKey: true},
+			{Name: "name", Type: arrow.BinaryTypes.String},
+		},
+	}
+}
+
+func testRecord(mem memory.Allocator, table *schema.Table, rows int) arrow.Record {
+	builder := array.NewRecordBuilder(mem, table.ToArrowSchema())
+	defer builder.Release()
+
+	for i := 0; i < rows; i++ {
+		builder.Field(0).(*array.Int64Builder).Append(int64(i))
+		builder.Field(1).(*array.StringBuilder).Append("row")
+	}
+	return builder.NewRecord()
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// inFlightLimiter limits the number of batches and bytes sent to the server which were not yet acknowledged.
+// A nil limiter doesn't limit anything.
+type inFlightLimiter struct {
+	mutex      sync.Mutex
+	changed    chan struct{}
+	batches    int
+	bytes      int64
+	maxBatches int
+	maxBytes   int64
+}
+
+func newInFlightLimiter(maxBatches int, maxBytes int64) *inFlightLimiter {
+	if maxBatches <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &inFlightLimiter{
+		changed:    make(chan struct{}),
+		maxBatches: maxBatches,
+		maxBytes:   maxBytes,
+	}
+}
+
+// acquire blocks until a batch of the given size fits into the limits.
+// A batch larger than the byte limit is let through once nothing else is in flight.
+func (l *inFlightLimiter) acquire(ctx context.Context, size int64) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.mutex.Lock()
+		if l.fits(size) {
+			l.batches++
+			l.bytes += size
+			l.mutex.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (l *inFlightLimiter) release(batches int, size int64) {
+	if l == nil || batches == 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.batches -= batches
+	l.bytes -= size
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// fits reports whether a batch of the given size can be sent. The mutex must be held.
+func (l *inFlightLimiter) fits(size int64) bool {
+	if l.batches == 0 {
+		return true
+	}
+	if l.maxBatches > 0 && l.batches >= l.maxBatches {
+		return false
+	}
+	if l.maxBytes > 0 && l.bytes+size > l.maxBytes {
+		return false
+	}
+	return true
+}
+
+// inFlightQueue keeps the sizes of the batches written to a single DoPut stream, in the order they were written.
+// The server acknowledges them in the same order with a PutResult each.
+type inFlightQueue struct {
+	mutex   sync.Mutex
+	batches []inFlightBatch
+	closed  bool
+	nextID  uint64
+}
+
+type inFlightBatch struct {
+	id   uint64
+	size int64
+}
+
+// push adds a batch to the queue and returns its id. It fails if the queue was cleared because the stream ended.
+func (q *inFlightQueue) push(size int64) (uint64, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return 0, false
+	}
+	q.nextID++
+	q.batches = append(q.batches, inFlightBatch{id: q.nextID, size: size})
+	return q.nextID, true
+}
+
+func (q *inFlightQueue) pop() (int64, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.batches) == 0 {
+		return 0, false
+	}
+	size := q.batches[0].size
+	q.batches = q.batches[1:]
+	return size, true
+}
+
+// remove removes the batch with the id, e.g. because writing it failed, and returns its size.
+// It fails if the batch was already acknowledged or cleared.
+func (q *inFlightQueue) remove(id uint64) (int64, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, batch := range q.batches {
+		if batch.id == id {
+			q.batches = append(q.batches[:i], q.batches[i+1:]...)
+			return batch.size, true
+		}
+	}
+	return 0, false
+}
+
+// clear empties and closes the queue and returns the number of batches and bytes it held.
+func (q *inFlightQueue) clear() (int, int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var size int64
+	for _, batch := range q.batches {
+		size += batch.size
+	}
+	batches := len(q.batches)
+	q.batches = nil
+	q.closed = true
+	return batches, size
+}
+
+// acquireInFlight blocks until the batch fits into the table and global in-flight limits.
+func (w *Writer) acquireInFlight(ctx context.Context, size int64) error {
+	if err := w.inFlightLimiter.acquire(ctx, size); err != nil {
+		return err
+	}
+	if err := w.client.inFlightLimiter.acquire(ctx, size); err != nil {
+		w.inFlightLimiter.release(1, size)
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) releaseInFlight(batches int, size int64) {
+	w.inFlightLimiter.release(batches, size)
+	w.client.inFlightLimiter.release(batches, size)
+}
+
+// limited reports whether any in-flight limit applies to the writer.
+func (w *Writer) limited() bool {
+	return w.inFlightLimiter != nil || w.client.inFlightLimiter != nil
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newInFlightLimiter(2, 100)
+
+	require.NoError(t, l.acquire(ctx, 60))
+	require.NoError(t, l.acquire(ctx, 30))
+
+	// The batch limit is reached.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.acquire(timeoutCtx, 1), context.DeadlineExceeded)
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.acquire(ctx, 50)
+	}()
+
+	// Releasing the small batch isn't enough for the byte limit.
+	l.release(1, 30)
+	select {
+	case <-acquired:
+		t.Fatal("acquired before enough bytes were released")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	l.release(1, 60)
+	require.NoError(t, <-acquired)
+
+	// A batch larger than the byte limit passes once nothing else is in flight.
+	l.release(1, 50)
+	require.NoError(t, l.acquire(ctx, 1000))
+}
+
+func TestInFlightLimiter_Disabled(t *testing.T) {
+	l := newInFlightLimiter(0, 0)
+	assert.Nil(t, l)
+	assert.NoError(t, l.acquire(context.Background(), 1))
+	l.release(1, 1)
+}
+
+func TestWriter_InFlightLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		// unblock releases the first batch after the second Insert started waiting for it.
+		unblock func(server *testFlightServer)
+		// dropAfter drops the first stream after the first batch, instead of sending its PutResult.
+		dropAfter int
+	}{
+		{
+			name: "should wait for the PutResult",
+			unblock: func(server *testFlightServer) {
+				close(server.holdResults)
+			},
+		},
+		{
+			name:      "should stop waiting once the stream is dropped",
+			dropAfter: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			server.dropAfter = tt.dropAfter
+			if tt.unblock != nil {
+				server.holdResults = make(chan struct{})
+			}
+			defer server.release()
+			addr := newTestFlightServer(t, server)
+			// Listing the address twice enables failover, which shortens the delay before reconnecting.
+			c := newTestClient(t, addr+","+addr, map[string]any{
+				"max_in_flight_batches": 1,
+			})
+
+			table := testTable("test_in_flight_limit")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			insert := func() error {
+				rec := testRecord(memory.DefaultAllocator, table, 10)
+				defer rec.Release()
+				return c.Insert(ctx, &message.WriteInsert{Record: rec})
+			}
+			require.NoError(t, insert())
+
+			inserted := make(chan error)
+			go func() {
+				inserted <- insert()
+			}()
+			if tt.unblock != nil {
+				select {
+				case err := <-inserted:
+					t.Fatalf("inserted before the first batch was acknowledged: %v", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+				tt.unblock(server)
+			}
+			require.NoError(t, <-inserted)
+			require.NoError(t, c.Close(ctx))
+
+			assert.GreaterOrEqual(t, server.rows("test_in_flight_limit"), int64(20))
+		})
+	}
+}
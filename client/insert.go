@@ -5,9 +5,34 @@ import (
 	"fmt"
 
 	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
 )
 
 func (c *Client) Insert(ctx context.Context, msg *message.WriteInsert) error {
+	tableName, _ := msg.Record.Schema().Metadata().GetValue(schema.MetadataTableName)
+	if !c.includeTable(tableName) {
+		return nil
+	}
+	if err := c.deletes.flush(ctx, tableName); err != nil {
+		return fmt.Errorf("failed to flush delete records: %w", err)
+	}
+	if c.transformsRecords() {
+		rec, err := c.transformRecord(msg.GetTable(), msg.Record)
+		if err != nil {
+			return fmt.Errorf("failed to transform record: %w", err)
+		}
+		defer rec.Release()
+		msg = &message.WriteInsert{Record: rec}
+	}
+
+	if c.dryRun != nil {
+		size, err := c.recordSize(msg.Record)
+		if err != nil {
+			return fmt.Errorf("failed to get record size: %w", err)
+		}
+		return c.dryRun.insert(msg.GetTable().Name, msg.Record, size)
+	}
+
 	writer, ok := c.getWriter(msg)
 	if !ok {
 		if err := c.createWriter(ctx, msg); err != nil {
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"regexp"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// hashType is the type of the columns masked by the `sha256` and `hmac` transforms.
+var hashType = &arrow.FixedSizeBinaryType{ByteWidth: sha256.Size}
+
+// mask applies a transform of the spec to the arrays of a column.
+type mask struct {
+	spec.Transform
+	pattern *regexp.Regexp
+}
+
+func newMasks(transforms []spec.Transform) ([]*mask, error) {
+	masks := make([]*mask, len(transforms))
+	for i, transform := range transforms {
+		masks[i] = &mask{Transform: transform}
+		if transform.Type != spec.TransformRedact {
+			continue
+		}
+		var err error
+		if masks[i].pattern, err = regexp.Compile(transform.Pattern); err != nil {
+			return nil, fmt.Errorf("failed to compile pattern of transform %d: %w", i, err)
+		}
+	}
+	return masks, nil
+}
+
+// hashes reports whether the transform hashes the values, which keeps distinct values distinct. Only hashed values
+// can be used as keys or matched by masking a predicate value the same way.
+func (m *mask) hashes() bool {
+	return m.Type == spec.TransformSHA256 || m.Type == spec.TransformHMAC
+}
+
+// dataType returns the type of the masked column.
+func (m *mask) dataType(dt arrow.DataType) (arrow.DataType, error) {
+	switch m.Type {
+	case spec.TransformSHA256, spec.TransformHMAC:
+		return hashType, nil
+	case spec.TransformTruncate:
+		if !isStringOrBinary(dt) {
+			return nil, fmt.Errorf("the %s transform doesn't support the type %s", m.Type, dt)
+		}
+	case spec.TransformRedact:
+		if !isString(dt) {
+			return nil, fmt.Errorf("the %s transform doesn't support the type %s", m.Type, dt)
+		}
+	}
+	return dt, nil
+}
+
+// apply returns the masked array. The returned array must be released.
+func (m *mask) apply(mem memory.Allocator, arr arrow.Array) (arrow.Array, error) {
+	switch m.Type {
+	case spec.TransformSHA256:
+		return hashArray(mem, arr, func() hash.Hash {
+			h := sha256.New()
+			h.Write([]byte(m.Salt))
+			return h
+		}), nil
+	case spec.TransformHMAC:
+		return hashArray(mem, arr, func() hash.Hash {
+			return hmac.New(sha256.New, []byte(m.Key))
+		}), nil
+	case spec.TransformNull:
+		return array.MakeArrayOfNull(mem, arr.DataType(), arr.Len()), nil
+	case spec.TransformTruncate:
+		return mapStrings(mem, arr, func(v string) string {
+			if isString(arr.DataType()) {
+				if runes := []rune(v); len(runes) > m.Length {
+					return string(runes[:m.Length])
+				}
+				return v
+			}
+			if len(v) > m.Length {
+				return v[:m.Length]
+			}
+			return v
+		})
+	case spec.TransformRedact:
+		return mapStrings(mem, arr, func(v string) string {
+			return m.pattern.ReplaceAllString(v, m.Replacement)
+		})
+	default:
+		return nil, fmt.Errorf("unknown transform %s", m.Type)
+	}
+}
+
+// hashArray hashes the values of the array. Values of types other than strings and binaries are hashed
+// in their string representation.
+func hashArray(mem memory.Allocator, arr arrow.Array, newHash func() hash.Hash) arrow.Array {
+	builder := array.NewFixedSizeBinaryBuilder(mem, hashType)
+	defer builder.Release()
+
+	builder.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		h := newHash()
+		if v, ok := stringOrBinaryValue(arr, i); ok {
+			h.Write([]byte(v))
+		} else {
+			h.Write([]byte(arr.ValueStr(i)))
+		}
+		builder.Append(h.Sum(nil))
+	}
+	return builder.NewArray()
+}
+
+// stringAppender is implemented by the builders of strings and binaries.
+type stringAppender interface {
+	array.Builder
+	AppendString(string)
+}
+
+// mapStrings maps the values of a string or binary array, keeping its type.
+func mapStrings(mem memory.Allocator, arr arrow.Array, fn func(string) string) (arrow.Array, error) {
+	builder, ok := array.NewBuilder(mem, arr.DataType()).(stringAppender)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %s", arr.DataType())
+	}
+	defer builder.Release()
+
+	builder.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		v, _ := stringOrBinaryValue(arr, i)
+		builder.AppendString(fn(v))
+	}
+	return builder.NewArray(), nil
+}
+
+func stringOrBinaryValue(arr arrow.Array, i int) (string, bool) {
+	switch arr := arr.(type) {
+	case *array.String:
+		return arr.Value(i), true
+	case *array.LargeString:
+		return arr.Value(i), true
+	case *array.Binary:
+		return string(arr.Value(i)), true
+	case *array.LargeBinary:
+		return string(arr.Value(i)), true
+	default:
+		return "", false
+	}
+}
+
+func isString(dt arrow.DataType) bool {
+	return arrow.TypeEqual(dt, arrow.BinaryTypes.String) || arrow.TypeEqual(dt, arrow.BinaryTypes.LargeString)
+}
+
+func isStringOrBinary(dt arrow.DataType) bool {
+	return isString(dt) || arrow.TypeEqual(dt, arrow.BinaryTypes.Binary) || arrow.TypeEqual(dt, arrow.BinaryTypes.LargeBinary)
+}
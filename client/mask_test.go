@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func TestMask_Apply(t *testing.T) {
+	salted := sha256.Sum256([]byte("salt" + "alice@example.com"))
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("alice@example.com"))
+
+	tests := []struct {
+		name      string
+		transform spec.Transform
+		want      []any
+	}{
+		{
+			name:      "sha256",
+			transform: spec.Transform{Type: spec.TransformSHA256, Salt: "salt"},
+			want:      []any{salted[:], nil},
+		},
+		{
+			name:      "hmac",
+			transform: spec.Transform{Type: spec.TransformHMAC, Key: "key"},
+			want:      []any{mac.Sum(nil), nil},
+		},
+		{
+			name:      "null",
+			transform: spec.Transform{Type: spec.TransformNull},
+			want:      []any{nil, nil},
+		},
+		{
+			name:      "truncate",
+			transform: spec.Transform{Type: spec.TransformTruncate, Length: 5},
+			want:      []any{"alice", nil},
+		},
+		{
+			name:      "redact",
+			transform: spec.Transform{Type: spec.TransformRedact, Pattern: `^[^@]+`, Replacement: "***"},
+			want:      []any{"***@example.com", nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer mem.AssertSize(t, 0)
+
+			builder := array.NewStringBuilder(mem)
+			builder.AppendValues([]string{"alice@example.com", ""}, []bool{true, false})
+			arr := builder.NewArray()
+			builder.Release()
+			defer arr.Release()
+
+			masks, err := newMasks([]spec.Transform{tt.transform})
+			require.NoError(t, err)
+			masked, err := masks[0].apply(mem, arr)
+			require.NoError(t, err)
+			defer masked.Release()
+
+			dataType, err := masks[0].dataType(arr.DataType())
+			require.NoError(t, err)
+			require.True(t, arrow.TypeEqual(dataType, masked.DataType()))
+			for i, want := range tt.want {
+				if want == nil {
+					assert.True(t, masked.IsNull(i))
+					continue
+				}
+				switch masked := masked.(type) {
+				case *array.FixedSizeBinary:
+					assert.Equal(t, want, masked.Value(i))
+				case *array.String:
+					assert.Equal(t, want, masked.Value(i))
+				default:
+					t.Fatalf("unexpected array type %T", masked)
+				}
+			}
+		})
+	}
+}
+
+func TestMask_DataType(t *testing.T) {
+	m := &mask{Transform: spec.Transform{Type: spec.TransformRedact}}
+	_, err := m.dataType(arrow.PrimitiveTypes.Int64)
+	require.ErrorContains(t, err, "the redact transform doesn't support the type int64")
+}
+
+func TestClient_Transforms(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"transforms": []map[string]any{
+			{"columns": []string{"test_transform.name"}, "type": "sha256", "salt": "salt"},
+		},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_transform")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	assert.Equal(t, int64(10), server.rows(table.Name))
+	assert.True(t, arrow.TypeEqual(hashType, server.schemas[table.Name].Field(1).Type))
+	migrated := server.migratedSchema(t, table.Name)
+	assert.True(t, arrow.TypeEqual(hashType, migrated.Field(1).Type))
+
+	want := sha256.Sum256([]byte("salt" + "row"))
+	for _, r := range server.records[table.Name] {
+		for i := 0; i < int(r.NumRows()); i++ {
+			assert.Equal(t, want[:], r.Column(1).(*array.FixedSizeBinary).Value(i))
+		}
+	}
+}
+
+func TestClient_TransformsDeleteRecord(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"transforms": []map[string]any{
+			{"columns": []string{"test_transform_delete.name"}, "type": "sha256", "salt": "salt"},
+			{"columns": []string{"test_transform_redact.name"}, "type": "redact", "pattern": ".*"},
+			{"columns": []string{"test_transform_truncate.name"}, "type": "truncate", "length": 1},
+		},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_transform_delete")
+	rec := testRecord(memory.DefaultAllocator, table, 1)
+	defer rec.Release()
+	require.NoError(t, c.DeleteRecord(ctx, &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{
+		TableName: table.Name,
+		WhereClause: message.PredicateGroups{{
+			GroupingType: "AND",
+			Predicates:   message.Predicates{{Operator: "eq", Column: "name", Record: rec}},
+		}},
+	}}))
+
+	var msg pb.Write_MessageDeleteRecord
+	require.NoError(t, proto.Unmarshal(server.actions[len(server.actions)-1].GetBody(), &msg))
+	predicate, err := pb.NewRecordFromBytes(msg.WhereClause[0].Predicates[0].Record)
+	require.NoError(t, err)
+	defer predicate.Release()
+	want := sha256.Sum256([]byte("salt" + "row"))
+	assert.Equal(t, want[:], predicate.Column(1).(*array.FixedSizeBinary).Value(0))
+
+	// Predicates on columns whose masked values aren't one-to-one would match other records too.
+	for _, transform := range []string{"redact", "truncate"} {
+		masked := testTable("test_transform_" + transform)
+		maskedRec := testRecord(memory.DefaultAllocator, masked, 1)
+		err = c.DeleteRecord(ctx, &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{
+			TableName: masked.Name,
+			WhereClause: message.PredicateGroups{{
+				GroupingType: "AND",
+				Predicates:   message.Predicates{{Operator: "eq", Column: "name", Record: maskedRec}},
+			}},
+		}})
+		maskedRec.Release()
+		require.ErrorContains(t, err, "can't delete records of table test_transform_"+transform+" by the column name masked by the "+transform+" transform")
+	}
+}
+
+func TestClient_TransformsPrimaryKey(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"transforms": []map[string]any{
+			{"columns": []string{"test_transform_pk.id"}, "type": "null"},
+		},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_transform_pk")
+	err := c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table})
+	require.ErrorContains(t, err, "the null transform can't mask the primary key column id of table test_transform_pk")
+	assert.Empty(t, server.schemas)
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// trackingAllocator counts the bytes in use by the client. Besides the Arrow buffers allocated through it,
+// records written by the client (e.g. unacknowledged batches) are accounted with acquire and unreserve.
+type trackingAllocator struct {
+	allocator memory.Allocator
+	mutex     sync.Mutex
+	changed   chan struct{}
+	allocated int64
+	ceiling   int64
+}
+
+// Assert trackingAllocator implements memory.Allocator interface.
+var _ memory.Allocator = (*trackingAllocator)(nil)
+
+func newTrackingAllocator(allocator memory.Allocator, ceiling int64) *trackingAllocator {
+	return &trackingAllocator{
+		allocator: allocator,
+		changed:   make(chan struct{}),
+		ceiling:   ceiling,
+	}
+}
+
+func (a *trackingAllocator) Allocate(size int) []byte {
+	b := a.allocator.Allocate(size)
+	a.add(int64(size))
+	return b
+}
+
+func (a *trackingAllocator) Reallocate(size int, b []byte) []byte {
+	previous := len(b)
+	b = a.allocator.Reallocate(size, b)
+	a.add(int64(size - previous))
+	return b
+}
+
+func (a *trackingAllocator) Free(b []byte) {
+	size := len(b)
+	a.allocator.Free(b)
+	a.add(-int64(size))
+}
+
+// Allocated returns the number of bytes in use.
+func (a *trackingAllocator) Allocated() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.allocated
+}
+
+func (a *trackingAllocator) unreserve(size int64) {
+	a.add(-size)
+}
+
+// acquire blocks until the bytes in use leave room for the size below the ceiling and reserves it.
+// The size must be unreserved once it is no longer in use. A record larger than the ceiling is let through
+// once nothing else is in use. Without a ceiling the size is reserved right away.
+func (a *trackingAllocator) acquire(ctx context.Context, size int64) error {
+	for {
+		a.mutex.Lock()
+		if a.ceiling <= 0 || a.allocated == 0 || a.allocated+size <= a.ceiling {
+			a.allocated += size
+			a.mutex.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (a *trackingAllocator) add(size int64) {
+	if size == 0 {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.allocated += size
+	if size < 0 {
+		close(a.changed)
+		a.changed = make(chan struct{})
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackingAllocator(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	ctx := context.Background()
+	a := newTrackingAllocator(mem, 100)
+	b := a.Allocate(64)
+	assert.Equal(t, int64(64), a.Allocated())
+	require.NoError(t, a.acquire(ctx, 30))
+	assert.Equal(t, int64(94), a.Allocated())
+
+	// The reserved bytes count towards the ceiling, so concurrent records can't overshoot it.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, a.acquire(timeoutCtx, 10), context.DeadlineExceeded)
+
+	b = a.Reallocate(128, b)
+	assert.Equal(t, int64(158), a.Allocated())
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- a.acquire(ctx, 50)
+	}()
+	a.Free(b)
+	require.NoError(t, <-acquired)
+	assert.Equal(t, int64(80), a.Allocated())
+
+	a.unreserve(80)
+	// A record larger than the ceiling passes once nothing else is in use.
+	require.NoError(t, a.acquire(ctx, 1000))
+	a.unreserve(1000)
+	assert.Equal(t, int64(0), a.Allocated())
+}
+
+func TestClient_NoLeaks(t *testing.T) {
+	for _, transport := range []string{"do_put", "do_exchange"} {
+		t.Run(transport, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+			defer mem.AssertSize(t, 0)
+
+			server := newTestFlightService()
+			defer server.release()
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"write_transport": transport})
+			c.allocator = newTrackingAllocator(mem, 0)
+
+			ctx := context.Background()
+			table := testTable("test_leaks")
+			for i := 0; i < 3; i++ {
+				rec := testRecord(mem, table, 10)
+				err := c.Insert(ctx, &message.WriteInsert{Record: rec})
+				rec.Release()
+				require.NoError(t, err)
+			}
+			require.NoError(t, c.closeWriters(ctx))
+			require.Equal(t, int64(30), server.rows(table.Name))
+
+			res := make(chan arrow.Record)
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Read(ctx, table, res)
+				close(res)
+			}()
+			var rows int64
+			for rec := range res {
+				rows += rec.NumRows()
+				rec.Release()
+			}
+			require.NoError(t, <-done)
+			require.NoError(t, c.Close(ctx))
+
+			assert.Equal(t, int64(30), rows)
+			assert.Equal(t, int64(0), c.allocator.Allocated())
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// attributeSyncTableName is the table attribute used by the plugin SDK sync metrics, so both can be joined.
+const attributeSyncTableName = attribute.Key("sync.table.name")
+
+// clientMetrics records the per-table throughput and errors with the meter of the global meter provider,
+// which is set by the plugin SDK when OpenTelemetry is enabled. It also keeps the totals for the summary
+// logged when the client is closed. A nil clientMetrics doesn't record anything.
+type clientMetrics struct {
+	rowsWritten    metric.Int64Counter
+	bytesWritten   metric.Int64Counter
+	writeRetries   metric.Int64Counter
+	skippedRecords metric.Int64Counter
+	writeDuration  metric.Float64Histogram
+	actions        metric.Int64Counter
+	actionErrors   metric.Int64Counter
+	actionDuration metric.Float64Histogram
+	affectedRows   metric.Int64Counter
+	rowsRead       metric.Int64Counter
+	bytesRead      metric.Int64Counter
+	readDuration   metric.Float64Histogram
+
+	mutex  sync.Mutex
+	start  time.Time
+	tables map[string]*tableMetrics
+}
+
+// tableMetrics are the totals of a single table.
+type tableMetrics struct {
+	rowsWritten    int64
+	bytesWritten   int64
+	writeRetries   int64
+	skippedRecords int64
+	actions        int64
+	actionErrors   int64
+	actionDuration time.Duration
+	affectedRows   int64
+	rowsRead       int64
+	bytesRead      int64
+}
+
+func newClientMetrics() (*clientMetrics, error) {
+	meter := otel.Meter(tracerName)
+	var errs []error
+	counter := func(name, description, unit string) metric.Int64Counter {
+		counter, err := meter.Int64Counter(name, metric.WithDescription(description), metric.WithUnit(unit))
+		errs = append(errs, err)
+		return counter
+	}
+	histogram := func(name, description string) metric.Float64Histogram {
+		histogram, err := meter.Float64Histogram(name, metric.WithDescription(description), metric.WithUnit("s"))
+		errs = append(errs, err)
+		return histogram
+	}
+
+	m := &clientMetrics{
+		rowsWritten:    counter("arrowflight.write.rows", "Number of rows written to a table", "{row}"),
+		bytesWritten:   counter("arrowflight.write.bytes", "Number of bytes written to a table", "By"),
+		writeRetries:   counter("arrowflight.write.retries", "Number of write attempts retried for a table", "{retry}"),
+		skippedRecords: counter("arrowflight.write.skipped_records", "Number of records skipped for a table", "{record}"),
+		writeDuration:  histogram("arrowflight.write.duration", "Duration of writing a record to a table"),
+		actions:        counter("arrowflight.action.count", "Number of actions sent for a table", "{action}"),
+		actionErrors:   counter("arrowflight.action.errors", "Number of actions failed for a table", "{action}"),
+		actionDuration: histogram("arrowflight.action.duration", "Duration of an action"),
+		affectedRows:   counter("arrowflight.action.affected_rows", "Number of rows affected by the actions sent for a table", "{row}"),
+		rowsRead:       counter("arrowflight.read.rows", "Number of rows read from a table", "{row}"),
+		bytesRead:      counter("arrowflight.read.bytes", "Number of bytes read from a table", "By"),
+		readDuration:   histogram("arrowflight.read.duration", "Duration of reading a table endpoint"),
+		start:          time.Now(),
+		tables:         make(map[string]*tableMetrics),
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to create metrics: %w", err)
+	}
+	return m, nil
+}
+
+// table returns the totals of the table, creating them if needed. The mutex must be held.
+func (m *clientMetrics) table(tableName string) *tableMetrics {
+	table, ok := m.tables[tableName]
+	if !ok {
+		table = &tableMetrics{}
+		m.tables[tableName] = table
+	}
+	return table
+}
+
+func (m *clientMetrics) recordWrite(ctx context.Context, tableName string, rows, bytes int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	attributes := metric.WithAttributes(attributeSyncTableName.String(tableName))
+	m.rowsWritten.Add(ctx, rows, attributes)
+	m.bytesWritten.Add(ctx, bytes, attributes)
+	m.writeDuration.Record(ctx, duration.Seconds(), attributes)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	table := m.table(tableName)
+	table.rowsWritten += rows
+	table.bytesWritten += bytes
+}
+
+func (m *clientMetrics) recordRetry(ctx context.Context, tableName string) {
+	if m == nil {
+		return
+	}
+
+	m.writeRetries.Add(ctx, 1, metric.WithAttributes(attributeSyncTableName.String(tableName)))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.table(tableName).writeRetries++
+}
+
+func (m *clientMetrics) recordSkipped(ctx context.Context, tableName string) {
+	if m == nil {
+		return
+	}
+
+	m.skippedRecords.Add(ctx, 1, metric.WithAttributes(attributeSyncTableName.String(tableName)))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.table(tableName).skippedRecords++
+}
+
+// recordAction records an action. Actions which don't concern a single table have an empty table name.
+func (m *clientMetrics) recordAction(ctx context.Context, actionType, tableName string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	attributes := metric.WithAttributes(attributeSyncTableName.String(tableName), attributeAction.String(actionType))
+	m.actions.Add(ctx, 1, attributes)
+	if err != nil {
+		m.actionErrors.Add(ctx, 1, attributes)
+	}
+	m.actionDuration.Record(ctx, duration.Seconds(), attributes)
+
+	if len(tableName) == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	table := m.table(tableName)
+	table.actions++
+	if err != nil {
+		table.actionErrors++
+	}
+	table.actionDuration += duration
+}
+
+// recordAffectedRows records the rows affected by an action, as reported in its results.
+func (m *clientMetrics) recordAffectedRows(ctx context.Context, actionType, tableName string, rows int64) {
+	if m == nil {
+		return
+	}
+
+	m.affectedRows.Add(ctx, rows, metric.WithAttributes(attributeSyncTableName.String(tableName), attributeAction.String(actionType)))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.table(tableName).affectedRows += rows
+}
+
+// recordActionFailure records an action which succeeded as a call, but which the ArrowFlight service reported as failed in its results.
+func (m *clientMetrics) recordActionFailure(ctx context.Context, actionType, tableName string) {
+	if m == nil {
+		return
+	}
+
+	m.actionErrors.Add(ctx, 1, metric.WithAttributes(attributeSyncTableName.String(tableName), attributeAction.String(actionType)))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.table(tableName).actionErrors++
+}
+
+func (m *clientMetrics) recordRead(ctx context.Context, tableName string, rows, bytes int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	attributes := metric.WithAttributes(attributeSyncTableName.String(tableName))
+	m.rowsRead.Add(ctx, rows, attributes)
+	m.bytesRead.Add(ctx, bytes, attributes)
+	m.readDuration.Record(ctx, duration.Seconds(), attributes)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	table := m.table(tableName)
+	table.rowsRead += rows
+	table.bytesRead += bytes
+}
+
+// logSummary logs the totals of every table, sorted by table name.
+func (m *clientMetrics) logSummary(logger zerolog.Logger) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tableNames := make([]string, 0, len(m.tables))
+	for tableName := range m.tables {
+		tableNames = append(tableNames, tableName)
+	}
+	slices.Sort(tableNames)
+
+	elapsed := time.Since(m.start)
+	for _, tableName := range tableNames {
+		table := m.tables[tableName]
+		logger.Info().
+			Str("tableName", tableName).
+			Int64("rowsWritten", table.rowsWritten).
+			Int64("bytesWritten", table.bytesWritten).
+			Float64("rowsPerSecond", float64(table.rowsWritten)/elapsed.Seconds()).
+			Int64("writeRetries", table.writeRetries).
+			Int64("skippedRecords", table.skippedRecords).
+			Int64("actions", table.actions).
+			Int64("actionErrors", table.actionErrors).
+			Dur("actionDuration", table.actionDuration).
+			Int64("affectedRows", table.affectedRows).
+			Int64("rowsRead", table.rowsRead).
+			Int64("bytesRead", table.bytesRead).
+			Msg("table metrics")
+	}
+}
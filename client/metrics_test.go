@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestClient_Metrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(provider)
+	t.Cleanup(func() {
+		otel.SetMeterProvider(previous)
+	})
+
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"max_call_send_msg_size": 2048})
+	ctx := context.Background()
+
+	table := testTable("test_metrics")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+	large := testRecord(memory.DefaultAllocator, table, 1000)
+	defer large.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: large}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	close(res)
+	for r := range res {
+		r.Release()
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	sums := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, point := range sum.DataPoints {
+				if name, _ := point.Attributes.Value(attributeSyncTableName); name.AsString() == table.Name {
+					sums[m.Name] += point.Value
+				}
+			}
+		}
+	}
+	assert.Equal(t, int64(20), sums["arrowflight.write.rows"])
+	assert.Positive(t, sums["arrowflight.write.bytes"])
+	assert.Equal(t, int64(1), sums["arrowflight.write.skipped_records"])
+	assert.Equal(t, int64(1), sums["arrowflight.action.count"])
+	assert.Equal(t, int64(20), sums["arrowflight.read.rows"])
+
+	totals := c.metrics.tables[table.Name]
+	assert.Equal(t, int64(20), totals.rowsWritten)
+	assert.Equal(t, int64(1), totals.skippedRecords)
+	assert.Equal(t, int64(1), totals.actions)
+	assert.Equal(t, int64(20), totals.rowsRead)
+
+	require.NoError(t, c.Close(ctx))
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 
 	"github.com/apache/arrow-go/v18/arrow/flight"
-	"github.com/apache/arrow-go/v18/arrow/memory"
 	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
 	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
 	"google.golang.org/protobuf/proto"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
 )
 
 const (
@@ -18,18 +20,77 @@ const (
 // MigrateTable is called when a table is created or updated
 func (c *Client) MigrateTable(ctx context.Context, msg *message.WriteMigrateTable) error {
 	table := msg.GetTable()
-	c.logger.Debug().Str("tableName", table.Name).Bool("forceMigrate", msg.MigrateForce).Msg("migrate table")
+	if !c.includeTable(table.Name) {
+		c.logger.Debug().Str("tableName", table.Name).Msg("table is excluded, skipping migrate table")
+		return nil
+	}
+	if err := c.deletes.flush(ctx, table.Name); err != nil {
+		return fmt.Errorf("failed to flush delete records: %w", err)
+	}
+	table, err := c.transformTable(table)
+	if err != nil {
+		return fmt.Errorf("failed to transform table: %w", err)
+	}
+	// The ArrowFlight service stores the table with the renamed columns and the types rewritten by `type_compatibility`.
+	renamed, err := c.namer.table(table)
+	if err != nil {
+		return fmt.Errorf("failed to rename table: %w", err)
+	}
+	stored := c.compat.table(renamed)
+	writeMode := c.writeMode(table)
+	migrateForce := msg.MigrateForce || c.spec.MigrateMode == spec.MigrateModeForced
+	c.logger.Debug().Str("tableName", table.Name).Bool("forceMigrate", migrateForce).Str("writeMode", writeMode).Msg("migrate table")
+	definition, err := newTableDefinition(stored, writeMode).marshal()
+	if err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		metadataWriteMode:       writeMode,
+		metadataTableDefinition: definition,
+	}
+
+	var old *schema.Table
+	if old, err = c.getTable(ctx, stored.Name); err != nil {
+		return fmt.Errorf("failed to get table: %w", err)
+	}
+	var changes, unsafe []schema.TableColumnChange
+	if old != nil {
+		changes = stored.GetChanges(old)
+		if len(changes) == 0 {
+			c.logger.Debug().Str("tableName", table.Name).Msg("table is up to date, skipping migrate table")
+			return nil
+		}
+		if unsafe = unsafeChanges(changes); len(unsafe) > 0 && !migrateForce {
+			err = fmt.Errorf("table %s requires unsafe changes (%s), set `migrate_mode: forced` to apply them", table.Name, describeChanges(unsafe))
+			if c.dryRun == nil {
+				return err
+			}
+			c.logger.Warn().Err(err).Str("tableName", table.Name).Msg("dry run: migrate table would fail")
+		}
+		if metadata[metadataTableChanges], err = marshalTableChanges(changes); err != nil {
+			return err
+		}
+	}
+	if c.dryRun != nil {
+		c.dryRun.migrateTable(stored.Name, migrateForce, definition, metadata[metadataTableChanges], len(changes), len(unsafe))
+		return nil
+	}
+
+	sc, err := c.namer.schema(table.Name, c.compat.schema(withSchemaMetadata(table.ToArrowSchema(), metadata)))
+	if err != nil {
+		return fmt.Errorf("failed to rename table: %w", err)
+	}
 	data, err := proto.Marshal(&pb.Write_MessageMigrateTable{
-		Table:        flight.SerializeSchema(table.ToArrowSchema(), memory.DefaultAllocator),
-		MigrateForce: msg.MigrateForce,
+		Table:        flight.SerializeSchema(sc, c.allocator),
+		MigrateForce: migrateForce,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal: %w", err)
 	}
-	var body []byte
-	if body, err = c.doAction(ctx, migrateTable, data); err != nil {
-		return fmt.Errorf("failed to doAction: %w", err)
+	affectedRows, err := c.doTableAction(ctx, migrateTable, stored.Name, data)
+	if err != nil {
+		return err
 	}
-	c.logger.Debug().Str("body", string(body)).Msg("migrate table result")
+	c.logger.Debug().Str("tableName", table.Name).Int64("affectedRows", affectedRows).Msg("migrated table")
 	return nil
 }
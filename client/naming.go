@@ -0,0 +1,165 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// metadataOriginalName is the field metadata naming the column a field was renamed from.
+const metadataOriginalName = "arrowflight:original_name"
+
+// namer renames the tables and columns to the names the ArrowFlight service stores.
+// A nil namer doesn't rename anything.
+type namer struct {
+	naming spec.Naming
+}
+
+func newNamer(s spec.Naming) *namer {
+	if !s.Enabled() {
+		return nil
+	}
+	return &namer{naming: s}
+}
+
+// tableName returns the name the ArrowFlight service stores the table under.
+func (n *namer) tableName(tableName string) string {
+	if n == nil {
+		return tableName
+	}
+	return n.naming.TableName(tableName)
+}
+
+// columnName returns the name the ArrowFlight service stores the column of the table under.
+func (n *namer) columnName(tableName, columnName string) string {
+	if n == nil {
+		return columnName
+	}
+	return n.naming.ColumnName(tableName, columnName)
+}
+
+// columnNames returns the renamed column names of the table, failing if two columns are renamed to the same name.
+func (n *namer) columnNames(tableName string, columnNames []string) ([]string, error) {
+	renamed := make([]string, len(columnNames))
+	seen := make(map[string]string, len(columnNames))
+	for i, columnName := range columnNames {
+		renamed[i] = n.columnName(tableName, columnName)
+		if other, ok := seen[renamed[i]]; ok {
+			return nil, fmt.Errorf("columns %s and %s of table %s are both renamed to %s", other, columnName, tableName, renamed[i])
+		}
+		seen[renamed[i]] = columnName
+	}
+	return renamed, nil
+}
+
+// table returns the table with the renamed table, parent table and columns, as the ArrowFlight service reports it.
+func (n *namer) table(table *schema.Table) (*schema.Table, error) {
+	if n == nil {
+		return table, nil
+	}
+	columnNames, err := n.columnNames(table.Name, table.Columns.Names())
+	if err != nil {
+		return nil, err
+	}
+	renamed := table.Copy(nil)
+	renamed.Name = n.tableName(table.Name)
+	if table.Parent != nil {
+		renamed.Parent = &schema.Table{Name: n.tableName(table.Parent.Name)}
+	}
+	for i := range renamed.Columns {
+		renamed.Columns[i].Name = columnNames[i]
+	}
+	return renamed, nil
+}
+
+// schema returns the schema of the table with the renamed fields, recording the original names in the field metadata.
+// The table names in the schema metadata are renamed as well.
+func (n *namer) schema(tableName string, sc *arrow.Schema) (*arrow.Schema, error) {
+	if n == nil {
+		return sc, nil
+	}
+	fields := sc.Fields()
+	columnNames := make([]string, len(fields))
+	for i, f := range fields {
+		columnNames[i] = f.Name
+	}
+	columnNames, err := n.columnNames(tableName, columnNames)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range fields {
+		if columnNames[i] == f.Name {
+			continue
+		}
+		keys, values := append(slices.Clone(f.Metadata.Keys()), metadataOriginalName), append(slices.Clone(f.Metadata.Values()), f.Name)
+		fields[i].Name, fields[i].Metadata = columnNames[i], arrow.NewMetadata(keys, values)
+	}
+	keys, values := sc.Metadata().Keys(), slices.Clone(sc.Metadata().Values())
+	for i, key := range keys {
+		if key == schema.MetadataTableName || key == schema.MetadataTableDependsOn {
+			values[i] = n.tableName(values[i])
+		}
+	}
+	metadata := arrow.NewMetadata(keys, values)
+	return arrow.NewSchema(fields, &metadata), nil
+}
+
+// record returns the record of the table with the renamed fields. The returned record must be released.
+func (n *namer) record(tableName string, rec arrow.Record) (arrow.Record, error) {
+	if n == nil {
+		rec.Retain()
+		return rec, nil
+	}
+	sc, err := n.schema(tableName, rec.Schema())
+	if err != nil {
+		return nil, err
+	}
+	return array.NewRecord(sc, rec.Columns(), rec.NumRows()), nil
+}
+
+// restoreRecord returns the record of the table read from the ArrowFlight service with the names of the table and its columns.
+// Fields which aren't the renamed column of the table are kept as they are. The returned record must be released.
+func (n *namer) restoreRecord(table *schema.Table, rec arrow.Record) arrow.Record {
+	original := make(map[string]string, len(table.Columns))
+	for _, column := range table.Columns {
+		original[n.columnName(table.Name, column.Name)] = column.Name
+	}
+	fields := rec.Schema().Fields()
+	for i, f := range fields {
+		if name, ok := original[f.Name]; ok {
+			fields[i].Name = name
+		}
+		if f.HasMetadata() {
+			if j := f.Metadata.FindKey(metadataOriginalName); j >= 0 {
+				keys, values := f.Metadata.Keys(), f.Metadata.Values()
+				fields[i].Metadata = arrow.NewMetadata(append(keys[:j:j], keys[j+1:]...), append(values[:j:j], values[j+1:]...))
+			}
+		}
+	}
+	keys, values := rec.Schema().Metadata().Keys(), slices.Clone(rec.Schema().Metadata().Values())
+	for i, key := range keys {
+		if key == schema.MetadataTableName {
+			values[i] = table.Name
+		}
+	}
+	metadata := arrow.NewMetadata(keys, values)
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), rec.Columns(), rec.NumRows())
+}
+
+// originalNames returns the record with the fields renamed back to the names recorded in the field metadata.
+// The returned record must be released.
+func originalNames(rec arrow.Record) arrow.Record {
+	fields := rec.Schema().Fields()
+	for i, f := range fields {
+		if name, ok := f.Metadata.GetValue(metadataOriginalName); ok {
+			fields[i].Name = name
+		}
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), rec.Columns(), rec.NumRows())
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func TestNamer_Names(t *testing.T) {
+	tests := []struct {
+		name       string
+		naming     spec.Naming
+		tableName  string
+		columnName string
+		wantTable  string
+		wantColumn string
+	}{
+		{
+			name:       "camel",
+			naming:     spec.Naming{TableConvention: "camel", ColumnConvention: "camel"},
+			tableName:  "aws_s3_buckets",
+			columnName: "_cq_source_name",
+			wantTable:  "awsS3Buckets",
+			wantColumn: "cqSourceName",
+		},
+		{
+			name:       "snake",
+			naming:     spec.Naming{TableConvention: "snake", ColumnConvention: "snake"},
+			tableName:  "awsS3Buckets",
+			columnName: "accountIDName",
+			wantTable:  "aws_s3_buckets",
+			wantColumn: "account_id_name",
+		},
+		{
+			name:       "upper keeps leading underscores",
+			naming:     spec.Naming{ColumnConvention: "upper"},
+			tableName:  "aws_s3_buckets",
+			columnName: "_cq_id",
+			wantTable:  "aws_s3_buckets",
+			wantColumn: "_CQ_ID",
+		},
+		{
+			name:       "strip prefixes before the convention",
+			naming:     spec.Naming{ColumnConvention: "camel", StripPrefixes: []string{"_cq_"}},
+			tableName:  "aws_s3_buckets",
+			columnName: "_cq_sync_time",
+			wantTable:  "aws_s3_buckets",
+			wantColumn: "syncTime",
+		},
+		{
+			name: "explicit names take precedence",
+			naming: spec.Naming{
+				Tables:           map[string]string{"aws_s3_buckets": "Buckets"},
+				TableConvention:  "upper",
+				Columns:          map[string]string{"_cq_id": "cq_id", "aws_s3_buckets._cq_id": "bucket_cq_id"},
+				ColumnConvention: "camel",
+			},
+			tableName:  "aws_s3_buckets",
+			columnName: "_cq_id",
+			wantTable:  "Buckets",
+			wantColumn: "bucket_cq_id",
+		},
+		{
+			name: "explicit column names of every table",
+			naming: spec.Naming{
+				Columns:          map[string]string{"_cq_id": "cq_id", "aws_s3_buckets._cq_id": "bucket_cq_id"},
+				ColumnConvention: "camel",
+			},
+			tableName:  "aws_ec2_instances",
+			columnName: "_cq_id",
+			wantTable:  "aws_ec2_instances",
+			wantColumn: "cq_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNamer(tt.naming)
+			require.NotNil(t, n)
+			assert.Equal(t, tt.wantTable, n.tableName(tt.tableName))
+			assert.Equal(t, tt.wantColumn, n.columnName(tt.tableName, tt.columnName))
+		})
+	}
+
+	assert.Nil(t, newNamer(spec.Naming{TableConvention: "none", ColumnConvention: "none"}))
+}
+
+func TestNamer_Collision(t *testing.T) {
+	n := newNamer(spec.Naming{StripPrefixes: []string{"_cq_"}})
+	table := &schema.Table{
+		Name: "test_naming",
+		Columns: schema.ColumnList{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+			schema.CqIDColumn,
+		},
+	}
+	_, err := n.table(table)
+	assert.EqualError(t, err, "columns id and _cq_id of table test_naming are both renamed to id")
+}
+
+func TestNamer_Record(t *testing.T) {
+	n := newNamer(spec.Naming{TableConvention: "camel", ColumnConvention: "camel"})
+	table := testTable("test_naming")
+	table.Columns = append(table.Columns, schema.CqSourceNameColumn)
+	rec := testSourceRecord(t, table, "source", 2)
+	defer rec.Release()
+
+	renamed, err := n.record(table.Name, rec)
+	require.NoError(t, err)
+	defer renamed.Release()
+	assert.Equal(t, "cqSourceName", renamed.ColumnName(2))
+	tableName, _ := renamed.Schema().Metadata().GetValue(schema.MetadataTableName)
+	assert.Equal(t, "testNaming", tableName)
+	originalName, _ := renamed.Schema().Field(2).Metadata.GetValue(metadataOriginalName)
+	assert.Equal(t, schema.CqSourceNameColumn.Name, originalName)
+	// The record written isn't changed.
+	assert.Equal(t, schema.CqSourceNameColumn.Name, rec.ColumnName(2))
+
+	original := originalNames(renamed)
+	defer original.Release()
+	assert.Equal(t, "source", newSyncContext(original, spec.WriteModeAppend).SourceName)
+
+	restored := n.restoreRecord(table, renamed)
+	defer restored.Release()
+	assert.True(t, restored.Schema().Equal(rec.Schema()), "want %v, got %v", rec.Schema(), restored.Schema())
+	assert.True(t, array.RecordEqual(rec, restored))
+}
+
+func TestClient_Naming(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"naming": map[string]any{
+			"tables":            map[string]string{"test_naming": "NamingTest"},
+			"columns":           map[string]string{"name": "displayName"},
+			"column_convention": "camel",
+		},
+	})
+	ctx := context.Background()
+
+	table := testTable("test_naming")
+	table.Columns = append(table.Columns, schema.CqSourceNameColumn)
+	rec := testSourceRecord(t, table, "source", 3)
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.DeleteStale(ctx, &message.WriteDeleteStale{TableName: table.Name, SourceName: "source", SyncTime: time.Now()}))
+	require.NoError(t, c.DeleteRecord(ctx, &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{
+		TableName: table.Name,
+		WhereClause: message.PredicateGroups{{
+			GroupingType: "AND",
+			Predicates:   message.Predicates{{Operator: "eq", Column: "name", Record: rec}},
+		}},
+	}}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	migrated := server.migratedSchema(t, "NamingTest")
+	assert.Equal(t, "id", migrated.Field(0).Name)
+	assert.Equal(t, "displayName", migrated.Field(1).Name)
+	assert.Equal(t, "cqSourceName", migrated.Field(2).Name)
+	var definition tableDefinition
+	definitionJSON, _ := migrated.Metadata().GetValue(metadataTableDefinition)
+	require.NoError(t, json.Unmarshal([]byte(definitionJSON), &definition))
+	assert.Equal(t, "NamingTest", definition.Name)
+	assert.Equal(t, "displayName", definition.Columns[1].Name)
+
+	assert.Equal(t, []string{"cloudquery", "arrowflight", "NamingTest"}, server.descriptors["NamingTest"].GetPath())
+	var cmd descriptorCommand
+	require.NoError(t, json.Unmarshal(server.descriptors["NamingTest"].GetCmd(), &cmd))
+	assert.Equal(t, "source", cmd.SyncContext.SourceName)
+	assert.Equal(t, "NamingTest", cmd.Table.Name)
+	require.Len(t, server.records["NamingTest"], 1)
+	assert.Equal(t, "displayName", server.records["NamingTest"][0].ColumnName(1))
+
+	var deleteStaleMsg pb.Write_MessageDeleteStale
+	require.NoError(t, proto.Unmarshal(server.actions[len(server.actions)-2].GetBody(), &deleteStaleMsg))
+	assert.Equal(t, "NamingTest", deleteStaleMsg.TableName)
+	var deleteRecordMsg pb.Write_MessageDeleteRecord
+	require.NoError(t, proto.Unmarshal(server.actions[len(server.actions)-1].GetBody(), &deleteRecordMsg))
+	assert.Equal(t, "NamingTest", deleteRecordMsg.TableName)
+	predicate := deleteRecordMsg.WhereClause[0].Predicates[0]
+	assert.Equal(t, "displayName", predicate.Column)
+	predicateRecord, err := pb.NewRecordFromBytes(predicate.Record)
+	require.NoError(t, err)
+	defer predicateRecord.Release()
+	assert.Equal(t, "displayName", predicateRecord.ColumnName(1))
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	close(res)
+	var rows int64
+	for r := range res {
+		tableName, _ := r.Schema().Metadata().GetValue(schema.MetadataTableName)
+		assert.Equal(t, table.Name, tableName)
+		assert.Equal(t, "name", r.ColumnName(1))
+		assert.Equal(t, schema.CqSourceNameColumn.Name, r.ColumnName(2))
+		assert.True(t, array.RecordEqual(rec, r), "want %v, got %v", rec, r)
+		rows += r.NumRows()
+		r.Release()
+	}
+	assert.Equal(t, rec.NumRows(), rows)
+}
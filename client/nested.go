@@ -0,0 +1,267 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/bitutil"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// nestedSeparator separates the name of a struct column from the names of its fields in the flattened column names.
+const nestedSeparator = "__"
+
+// nester rewrites nested columns for ArrowFlight services which only support flat schemas, either flattening structs
+// into a column per field or serializing nested values as JSON strings. Lists and maps are always serialized.
+// A nil nester doesn't rewrite anything.
+type nester struct {
+	flatten bool
+}
+
+func newNester(nestedColumns string) *nester {
+	switch nestedColumns {
+	case spec.NestedColumnsFlatten:
+		return &nester{flatten: true}
+	case spec.NestedColumnsJSON:
+		return &nester{}
+	default:
+		return nil
+	}
+}
+
+// serialized reports whether the values of the type are serialized as JSON strings.
+func (n *nester) serialized(dt arrow.DataType) bool {
+	switch dt.(type) {
+	case *arrow.StructType:
+		return !n.flatten
+	case arrow.NestedType:
+		return true
+	default:
+		return false
+	}
+}
+
+// columns returns the columns the column is written as.
+func (n *nester) columns(column schema.Column) schema.ColumnList {
+	if st, ok := column.Type.(*arrow.StructType); ok && n.flatten {
+		var columns schema.ColumnList
+		for _, f := range st.Fields() {
+			columns = append(columns, n.columns(schema.Column{Name: column.Name + nestedSeparator + f.Name, Type: f.Type})...)
+		}
+		return columns
+	}
+	if n.serialized(column.Type) {
+		column.Type = arrow.BinaryTypes.String
+	}
+	return schema.ColumnList{column}
+}
+
+// table returns the table with the rewritten nested columns.
+func (n *nester) table(table *schema.Table) *schema.Table {
+	if n == nil {
+		return table
+	}
+	columns := make(schema.ColumnList, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		columns = append(columns, n.columns(column)...)
+	}
+	rewritten := table.Copy(nil)
+	rewritten.Columns = columns
+	return rewritten
+}
+
+// record returns the record with the rewritten nested columns. The returned record must be released.
+func (n *nester) record(mem memory.Allocator, rec arrow.Record) (arrow.Record, error) {
+	if n == nil {
+		rec.Retain()
+		return rec, nil
+	}
+	var fields []arrow.Field
+	var columns []arrow.Array
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for i, column := range rec.Columns() {
+		if err := n.appendColumns(mem, rec.Schema().Field(i), column, &fields, &columns); err != nil {
+			return nil, fmt.Errorf("failed to rewrite column %s: %w", rec.Schema().Field(i).Name, err)
+		}
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows()), nil
+}
+
+// appendColumns appends the fields and arrays the array is written as.
+func (n *nester) appendColumns(mem memory.Allocator, f arrow.Field, arr arrow.Array, fields *[]arrow.Field, columns *[]arrow.Array) error {
+	if st, ok := f.Type.(*arrow.StructType); ok && n.flatten {
+		for j, child := range st.Fields() {
+			childArr := withParentNulls(mem, arr, arr.(*array.Struct).Field(j))
+			err := n.appendColumns(mem, arrow.Field{Name: f.Name + nestedSeparator + child.Name, Type: child.Type, Nullable: true, Metadata: child.Metadata}, childArr, fields, columns)
+			childArr.Release()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !n.serialized(f.Type) {
+		arr.Retain()
+		*fields, *columns = append(*fields, f), append(*columns, arr)
+		return nil
+	}
+
+	builder := array.NewStringBuilder(mem)
+	defer builder.Release()
+	builder.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		b, err := json.Marshal(arr.GetOneForMarshal(i))
+		if err != nil {
+			return fmt.Errorf("failed to serialize value: %w", err)
+		}
+		builder.Append(string(b))
+	}
+	f.Type = arrow.BinaryTypes.String
+	*fields, *columns = append(*fields, f), append(*columns, builder.NewArray())
+	return nil
+}
+
+// withParentNulls returns the field array of a struct array, which is null wherever the struct is null.
+// The returned array must be released.
+func withParentNulls(mem memory.Allocator, parent, child arrow.Array) arrow.Array {
+	data := child.Data()
+	if parent.NullN() == 0 || len(data.Buffers()) == 0 || data.DataType().ID() == arrow.NULL || data.DataType().ID() == arrow.SPARSE_UNION || data.DataType().ID() == arrow.DENSE_UNION {
+		child.Retain()
+		return child
+	}
+	bitmap := memory.NewResizableBuffer(mem)
+	defer bitmap.Release()
+	bitmap.Resize(int(bitutil.BytesForBits(int64(data.Offset() + data.Len()))))
+	memory.Set(bitmap.Bytes(), 0)
+	for i := 0; i < child.Len(); i++ {
+		if parent.IsValid(i) && child.IsValid(i) {
+			bitutil.SetBit(bitmap.Bytes(), data.Offset()+i)
+		}
+	}
+	buffers := slices.Clone(data.Buffers())
+	buffers[0] = bitmap
+	masked := array.NewData(data.DataType(), data.Len(), buffers, data.Children(), array.UnknownNullCount, data.Offset())
+	defer masked.Release()
+	return array.MakeFromData(masked)
+}
+
+// restoreRecord returns the record read from the ArrowFlight service with the nested columns of the table restored.
+// Columns which can't be found are left out, columns of other types are read as they are stored.
+// The returned record must be released.
+func (n *nester) restoreRecord(mem memory.Allocator, table *schema.Table, rec arrow.Record) (arrow.Record, error) {
+	var fields []arrow.Field
+	var columns []arrow.Array
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for _, column := range table.Columns {
+		f, arr, err := n.restoreColumn(mem, column.Name, column.Type, rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore column %s: %w", column.Name, err)
+		}
+		if arr == nil {
+			continue
+		}
+		fields, columns = append(fields, f), append(columns, arr)
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows()), nil
+}
+
+// restoreColumn returns the field and array of the column, or a nil array if the column can't be found.
+func (n *nester) restoreColumn(mem memory.Allocator, name string, dt arrow.DataType, rec arrow.Record) (arrow.Field, arrow.Array, error) {
+	if st, ok := dt.(*arrow.StructType); ok && n.flatten {
+		return n.restoreStruct(mem, name, st, rec)
+	}
+	indices := rec.Schema().FieldIndices(name)
+	if len(indices) == 0 {
+		return arrow.Field{}, nil, nil
+	}
+	f, arr := rec.Schema().Field(indices[0]), rec.Column(indices[0])
+	if !n.serialized(dt) || !arrow.TypeEqual(arr.DataType(), arrow.BinaryTypes.String) {
+		arr.Retain()
+		return f, arr, nil
+	}
+
+	builder := array.NewBuilder(mem, dt)
+	defer builder.Release()
+	builder.Reserve(arr.Len())
+	values := arr.(*array.String)
+	for i := 0; i < values.Len(); i++ {
+		if values.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		if err := builder.AppendValueFromString(values.Value(i)); err != nil {
+			return f, nil, fmt.Errorf("failed to deserialize value: %w", err)
+		}
+	}
+	f.Type = dt
+	return f, builder.NewArray(), nil
+}
+
+// restoreStruct returns the struct flattened into the columns of its fields. A row is null if all its fields are null.
+func (n *nester) restoreStruct(mem memory.Allocator, name string, st *arrow.StructType, rec arrow.Record) (arrow.Field, arrow.Array, error) {
+	fields := make([]arrow.Field, 0, st.NumFields())
+	children := make([]arrow.Array, 0, st.NumFields())
+	defer func() {
+		for _, child := range children {
+			child.Release()
+		}
+	}()
+	found := false
+	for _, child := range st.Fields() {
+		f, arr, err := n.restoreColumn(mem, name+nestedSeparator+child.Name, child.Type, rec)
+		if err != nil {
+			return arrow.Field{}, nil, err
+		}
+		if arr == nil {
+			f, arr = child, array.MakeArrayOfNull(mem, child.Type, int(rec.NumRows()))
+		} else {
+			found = true
+		}
+		f.Name, f.Nullable, f.Metadata = child.Name, child.Nullable, child.Metadata
+		fields, children = append(fields, f), append(children, arr)
+	}
+	if !found {
+		return arrow.Field{}, nil, nil
+	}
+
+	bitmap := memory.NewResizableBuffer(mem)
+	defer bitmap.Release()
+	bitmap.Resize(int(bitutil.BytesForBits(rec.NumRows())))
+	memory.Set(bitmap.Bytes(), 0)
+	nulls := 0
+	for i := 0; i < int(rec.NumRows()); i++ {
+		if slices.ContainsFunc(children, func(child arrow.Array) bool { return child.IsValid(i) }) {
+			bitutil.SetBit(bitmap.Bytes(), i)
+		} else {
+			nulls++
+		}
+	}
+	childData := make([]arrow.ArrayData, len(children))
+	for i, child := range children {
+		childData[i] = child.Data()
+	}
+	dt := arrow.StructOf(fields...)
+	data := array.NewData(dt, int(rec.NumRows()), []*memory.Buffer{bitmap}, childData, nulls, 0)
+	defer data.Release()
+	return arrow.Field{Name: name, Type: dt, Nullable: true}, array.MakeFromData(data), nil
+}
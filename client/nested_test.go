@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNestedTable(name string) *schema.Table {
+	owner := arrow.StructOf(arrow.Field{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true})
+	return &schema.Table{
+		Name: name,
+		Columns: schema.ColumnList{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64, PrimaryKey: true},
+			{Name: "meta", Type: arrow.StructOf(
+				arrow.Field{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+				arrow.Field{Name: "owner", Type: owner, Nullable: true},
+			)},
+			{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+			{Name: "labels", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.BinaryTypes.String)},
+		},
+	}
+}
+
+func testNestedRecord(t *testing.T, mem memory.Allocator, table *schema.Table) arrow.Record {
+	t.Helper()
+
+	builder := array.NewRecordBuilder(mem, table.ToArrowSchema())
+	defer builder.Release()
+
+	for _, row := range []string{
+		`{"id": 1, "meta": {"name": "a", "owner": {"id": 10}}, "tags": ["x", "y"], "labels": [{"key": "k", "value": "v"}]}`,
+		`{"id": 2, "meta": null, "tags": null, "labels": null}`,
+		`{"id": 3, "meta": {"name": "c", "owner": null}, "tags": [], "labels": []}`,
+	} {
+		require.NoError(t, builder.UnmarshalJSON([]byte(row)))
+	}
+	return builder.NewRecord()
+}
+
+func TestNester(t *testing.T) {
+	tests := []struct {
+		name          string
+		nestedColumns string
+		wantColumns   []string
+	}{
+		{
+			name:          "flatten",
+			nestedColumns: "flatten",
+			wantColumns:   []string{"id", "meta__name", "meta__owner__id", "tags", "labels"},
+		},
+		{
+			name:          "json",
+			nestedColumns: "json",
+			wantColumns:   []string{"id", "meta", "tags", "labels"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer mem.AssertSize(t, 0)
+
+			n := newNester(tt.nestedColumns)
+			table := testNestedTable("test_nested")
+			rec := testNestedRecord(t, mem, table)
+			defer rec.Release()
+
+			rewritten, err := n.record(mem, rec)
+			require.NoError(t, err)
+			defer rewritten.Release()
+			assert.Equal(t, tt.wantColumns, n.table(table).Columns.Names())
+			require.Equal(t, len(tt.wantColumns), int(rewritten.NumCols()))
+			for i, name := range tt.wantColumns {
+				assert.Equal(t, name, rewritten.ColumnName(i))
+				assert.True(t, arrow.TypeEqual(n.table(table).Columns[i].Type, rewritten.Column(i).DataType()))
+				if _, ok := rewritten.Column(i).DataType().(arrow.NestedType); ok {
+					t.Errorf("column %s is nested", name)
+				}
+			}
+
+			restored, err := n.restoreRecord(mem, table, rewritten)
+			require.NoError(t, err)
+			defer restored.Release()
+			assert.True(t, array.RecordEqual(rec, restored), "want %v, got %v", rec, restored)
+		})
+	}
+}
+
+func TestNester_FlattenParentNulls(t *testing.T) {
+	table := testNestedTable("test_nested")
+	rec := testNestedRecord(t, memory.DefaultAllocator, table)
+	defer rec.Release()
+
+	rewritten, err := newNester("flatten").record(memory.DefaultAllocator, rec)
+	require.NoError(t, err)
+	defer rewritten.Release()
+
+	name := rewritten.Column(1).(*array.String)
+	assert.Equal(t, "a", name.Value(0))
+	assert.True(t, name.IsNull(1))
+	ownerID := rewritten.Column(2).(*array.Int64)
+	assert.Equal(t, int64(10), ownerID.Value(0))
+	assert.True(t, ownerID.IsNull(1))
+	assert.True(t, ownerID.IsNull(2))
+}
+
+func TestClient_NestedColumns(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"nested_columns": "flatten"})
+	ctx := context.Background()
+
+	table := testNestedTable("test_nested_columns")
+	rec := testNestedRecord(t, memory.DefaultAllocator, table)
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	migrated := server.migratedSchema(t, table.Name)
+	names := make([]string, migrated.NumFields())
+	for i, f := range migrated.Fields() {
+		names[i] = f.Name
+	}
+	assert.Equal(t, []string{"id", "meta__name", "meta__owner__id", "tags", "labels"}, names)
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	close(res)
+	var rows int64
+	for r := range res {
+		assert.True(t, array.RecordEqual(rec, r), "want %v, got %v", rec, r)
+		rows += r.NumRows()
+		r.Release()
+	}
+	assert.Equal(t, rec.NumRows(), rows)
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// maxDecimal128Precision is the highest precision of a decimal128.
+const maxDecimal128Precision = 38
+
+var timeUnits = map[string]arrow.TimeUnit{
+	spec.TimestampUnitSecond:      arrow.Second,
+	spec.TimestampUnitMillisecond: arrow.Millisecond,
+	spec.TimestampUnitMicrosecond: arrow.Microsecond,
+	spec.TimestampUnitNanosecond:  arrow.Nanosecond,
+}
+
+// normalizer rewrites timestamps and decimals to the units and precisions of the spec. Values which would overflow
+// are rejected, values which would lose precision are rejected or truncated according to `precision_loss`.
+// A nil normalizer doesn't rewrite anything.
+type normalizer struct {
+	spec.Normalization
+}
+
+func newNormalizer(s spec.Normalization) *normalizer {
+	if !s.Enabled() {
+		return nil
+	}
+	return &normalizer{Normalization: s}
+}
+
+// dataType returns the normalized type. The elements of lists are normalized as well.
+func (n *normalizer) dataType(dt arrow.DataType) arrow.DataType {
+	switch dt := dt.(type) {
+	case *arrow.TimestampType:
+		normalized := &arrow.TimestampType{Unit: dt.Unit, TimeZone: dt.TimeZone}
+		if unit, ok := timeUnits[n.TimestampUnit]; ok {
+			normalized.Unit = unit
+		}
+		switch n.TimestampTimezone {
+		case "":
+		case spec.TimestampTimezoneNone:
+			normalized.TimeZone = ""
+		default:
+			normalized.TimeZone = n.TimestampTimezone
+		}
+		return normalized
+	case arrow.DecimalType:
+		if n.DecimalMaxPrecision == 0 {
+			return dt
+		}
+		precision, scale := min(dt.GetPrecision(), n.DecimalMaxPrecision), dt.GetScale()
+		scale = min(scale, precision)
+		if precision <= maxDecimal128Precision {
+			return &arrow.Decimal128Type{Precision: precision, Scale: scale}
+		}
+		return &arrow.Decimal256Type{Precision: precision, Scale: scale}
+	case *arrow.ListType:
+		elem := dt.ElemField()
+		elem.Type = n.dataType(elem.Type)
+		return arrow.ListOfField(elem)
+	case *arrow.LargeListType:
+		elem := dt.ElemField()
+		elem.Type = n.dataType(elem.Type)
+		return arrow.LargeListOfField(elem)
+	default:
+		return dt
+	}
+}
+
+// table returns the table with the normalized column types.
+func (n *normalizer) table(table *schema.Table) *schema.Table {
+	if n == nil {
+		return table
+	}
+	normalized := table.Copy(nil)
+	for i, column := range normalized.Columns {
+		normalized.Columns[i].Type = n.dataType(column.Type)
+	}
+	return normalized
+}
+
+// record returns the record with the normalized types and the number of values which lost precision.
+// The returned record must be released.
+func (n *normalizer) record(mem memory.Allocator, rec arrow.Record) (arrow.Record, int64, error) {
+	if n == nil {
+		rec.Retain()
+		return rec, 0, nil
+	}
+	fields := rec.Schema().Fields()
+	columns := make([]arrow.Array, 0, len(fields))
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	var truncated int64
+	for i, column := range rec.Columns() {
+		fields[i].Type = n.dataType(fields[i].Type)
+		normalized, columnTruncated, err := n.array(mem, column, fields[i].Type)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to normalize column %s: %w", fields[i].Name, err)
+		}
+		truncated += columnTruncated
+		columns = append(columns, normalized)
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows()), truncated, nil
+}
+
+// array returns the array normalized to dt and the number of values which lost precision. The returned array must be released.
+func (n *normalizer) array(mem memory.Allocator, arr arrow.Array, dt arrow.DataType) (arrow.Array, int64, error) {
+	if arrow.TypeEqual(arr.DataType(), dt) {
+		arr.Retain()
+		return arr, 0, nil
+	}
+	switch arr := arr.(type) {
+	case *array.Timestamp:
+		return n.timestamps(mem, arr, dt.(*arrow.TimestampType))
+	case *array.Decimal128, *array.Decimal256:
+		return n.decimals(mem, arr, dt.(arrow.DecimalType))
+	case array.ListLike:
+		values, truncated, err := n.array(mem, arr.ListValues(), dt.(arrow.ListLikeType).Elem())
+		if err != nil {
+			return nil, 0, err
+		}
+		defer values.Release()
+		return withListValues(arr, dt, values), truncated, nil
+	default:
+		return nil, 0, fmt.Errorf("can't normalize %s to %s", arr.DataType(), dt)
+	}
+}
+
+func (n *normalizer) timestamps(mem memory.Allocator, arr *array.Timestamp, dt *arrow.TimestampType) (arrow.Array, int64, error) {
+	from, to := arr.DataType().(*arrow.TimestampType).Unit, dt.Unit
+	builder := array.NewTimestampBuilder(mem, dt)
+	defer builder.Release()
+
+	builder.Reserve(arr.Len())
+	var truncated int64
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		v := int64(arr.Value(i))
+		switch {
+		case to > from:
+			multiplier := int64(math.Pow10(3 * int(to-from)))
+			if v > math.MaxInt64/multiplier || v < math.MinInt64/multiplier {
+				return nil, 0, fmt.Errorf("timestamp %d%s overflows unit %s", v, from, to)
+			}
+			v *= multiplier
+		case to < from:
+			divisor := int64(math.Pow10(3 * int(from-to)))
+			if v%divisor != 0 {
+				if n.PrecisionLoss != spec.PrecisionLossTruncate {
+					return nil, 0, fmt.Errorf("timestamp %d%s loses precision in unit %s", v, from, to)
+				}
+				truncated++
+			}
+			// Timestamps before the epoch are truncated to the earlier instant, as the division truncates toward zero.
+			if v%divisor < 0 {
+				v = v/divisor - 1
+			} else {
+				v /= divisor
+			}
+		}
+		builder.Append(arrow.Timestamp(v))
+	}
+	return builder.NewArray(), truncated, nil
+}
+
+func (n *normalizer) decimals(mem memory.Allocator, arr arrow.Array, dt arrow.DecimalType) (arrow.Array, int64, error) {
+	from := arr.DataType().(arrow.DecimalType)
+	builder := array.NewBuilder(mem, dt)
+	defer builder.Release()
+
+	builder.Reserve(arr.Len())
+	var truncated int64
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		var v decimal256.Num
+		switch arr := arr.(type) {
+		case *array.Decimal128:
+			v = decimal256.FromDecimal128(arr.Value(i))
+		case *array.Decimal256:
+			v = arr.Value(i)
+		}
+		if reduce := from.GetScale() - dt.GetScale(); reduce > 0 {
+			reduced := v.ReduceScaleBy(reduce, false)
+			if reduced.IncreaseScaleBy(reduce) != v {
+				if n.PrecisionLoss != spec.PrecisionLossTruncate {
+					return nil, 0, fmt.Errorf("decimal %s loses precision in %s", v.ToString(from.GetScale()), dt)
+				}
+				truncated++
+			}
+			v = reduced
+		}
+		if !v.FitsInPrecision(dt.GetPrecision()) {
+			return nil, 0, fmt.Errorf("decimal %s overflows %s", v.ToString(dt.GetScale()), dt)
+		}
+		switch builder := builder.(type) {
+		case *array.Decimal128Builder:
+			builder.Append(decimal128.FromBigInt(v.BigInt()))
+		case *array.Decimal256Builder:
+			builder.Append(v)
+		}
+	}
+	return builder.NewArray(), truncated, nil
+}
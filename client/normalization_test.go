@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func timestampArray(t *testing.T, mem memory.Allocator, dt *arrow.TimestampType, values ...int64) arrow.Array {
+	t.Helper()
+
+	builder := array.NewTimestampBuilder(mem, dt)
+	defer builder.Release()
+	for _, v := range values {
+		builder.Append(arrow.Timestamp(v))
+	}
+	return builder.NewArray()
+}
+
+func TestNormalizer_Timestamps(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization spec.Normalization
+		from          *arrow.TimestampType
+		values        []int64
+		want          []int64
+		wantType      *arrow.TimestampType
+		wantTruncated int64
+		wantErr       string
+	}{
+		{
+			name:          "should reduce the unit",
+			normalization: spec.Normalization{TimestampUnit: "us"},
+			from:          &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"},
+			values:        []int64{1_000, 2_000},
+			want:          []int64{1, 2},
+			wantType:      &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"},
+		},
+		{
+			name:          "should reject precision loss",
+			normalization: spec.Normalization{TimestampUnit: "us", PrecisionLoss: "error"},
+			from:          &arrow.TimestampType{Unit: arrow.Nanosecond},
+			values:        []int64{1_500},
+			wantErr:       "timestamp 1500ns loses precision in unit us",
+		},
+		{
+			name:          "should truncate precision loss",
+			normalization: spec.Normalization{TimestampUnit: "ms", PrecisionLoss: "truncate"},
+			from:          &arrow.TimestampType{Unit: arrow.Microsecond},
+			values:        []int64{1_500, 2_000},
+			want:          []int64{1, 2},
+			wantType:      &arrow.TimestampType{Unit: arrow.Millisecond},
+			wantTruncated: 1,
+		},
+		{
+			name:          "should truncate timestamps before the epoch to the earlier instant",
+			normalization: spec.Normalization{TimestampUnit: "ms", PrecisionLoss: "truncate"},
+			from:          &arrow.TimestampType{Unit: arrow.Microsecond},
+			values:        []int64{-1_500, -2_000},
+			want:          []int64{-2, -2},
+			wantType:      &arrow.TimestampType{Unit: arrow.Millisecond},
+			wantTruncated: 1,
+		},
+		{
+			name:          "should reject overflow",
+			normalization: spec.Normalization{TimestampUnit: "ns", PrecisionLoss: "truncate"},
+			from:          &arrow.TimestampType{Unit: arrow.Second},
+			values:        []int64{10_000_000_000},
+			wantErr:       "timestamp 10000000000s overflows unit ns",
+		},
+		{
+			name:          "should remove the timezone",
+			normalization: spec.Normalization{TimestampTimezone: "none"},
+			from:          &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"},
+			values:        []int64{1},
+			want:          []int64{1},
+			wantType:      &arrow.TimestampType{Unit: arrow.Microsecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer mem.AssertSize(t, 0)
+
+			n := newNormalizer(tt.normalization)
+			arr := timestampArray(t, mem, tt.from, tt.values...)
+			defer arr.Release()
+
+			normalized, truncated, err := n.array(mem, arr, n.dataType(tt.from))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer normalized.Release()
+			assert.True(t, arrow.TypeEqual(tt.wantType, normalized.DataType()))
+			assert.Equal(t, tt.wantTruncated, truncated)
+			for i, want := range tt.want {
+				assert.Equal(t, arrow.Timestamp(want), normalized.(*array.Timestamp).Value(i))
+			}
+		})
+	}
+}
+
+func TestNormalizer_Decimals(t *testing.T) {
+	tests := []struct {
+		name          string
+		normalization spec.Normalization
+		from          arrow.DecimalType
+		value         string
+		wantType      arrow.DataType
+		want          string
+		wantTruncated int64
+		wantErr       string
+	}{
+		{
+			name:          "should cap decimal256 as decimal128",
+			normalization: spec.Normalization{DecimalMaxPrecision: 38},
+			from:          &arrow.Decimal256Type{Precision: 50, Scale: 2},
+			value:         "1234.56",
+			wantType:      &arrow.Decimal128Type{Precision: 38, Scale: 2},
+			want:          "1234.56",
+		},
+		{
+			name:          "should reject overflow",
+			normalization: spec.Normalization{DecimalMaxPrecision: 5},
+			from:          &arrow.Decimal256Type{Precision: 50, Scale: 2},
+			value:         "1234.56",
+			wantErr:       "decimal 1234.56 overflows decimal(5, 2)",
+		},
+		{
+			name:          "should reject precision loss",
+			normalization: spec.Normalization{DecimalMaxPrecision: 3, PrecisionLoss: "error"},
+			from:          &arrow.Decimal128Type{Precision: 10, Scale: 5},
+			value:         "0.12345",
+			wantErr:       "decimal 0.12345 loses precision in decimal(3, 3)",
+		},
+		{
+			name:          "should truncate precision loss",
+			normalization: spec.Normalization{DecimalMaxPrecision: 3, PrecisionLoss: "truncate"},
+			from:          &arrow.Decimal128Type{Precision: 10, Scale: 5},
+			value:         "0.12345",
+			wantType:      &arrow.Decimal128Type{Precision: 3, Scale: 3},
+			want:          "0.123",
+			wantTruncated: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer mem.AssertSize(t, 0)
+
+			builder := array.NewBuilder(mem, tt.from)
+			require.NoError(t, builder.AppendValueFromString(tt.value))
+			arr := builder.NewArray()
+			builder.Release()
+			defer arr.Release()
+
+			n := newNormalizer(tt.normalization)
+			normalized, truncated, err := n.array(mem, arr, n.dataType(tt.from))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer normalized.Release()
+			assert.True(t, arrow.TypeEqual(tt.wantType, normalized.DataType()), "want %s, got %s", tt.wantType, normalized.DataType())
+			assert.Equal(t, tt.want, normalized.ValueStr(0))
+			assert.Equal(t, tt.wantTruncated, truncated)
+		})
+	}
+}
+
+func TestClient_Normalization(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"normalization": map[string]any{"timestamp_unit": "us", "decimal_max_precision": 38},
+	})
+	ctx := context.Background()
+
+	table := &schema.Table{
+		Name: "test_normalization",
+		Columns: schema.ColumnList{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64, PrimaryKey: true},
+			{Name: "created_at", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "amount", Type: &arrow.Decimal256Type{Precision: 76, Scale: 2}},
+		},
+	}
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, table.ToArrowSchema())
+	builder.Field(0).(*array.Int64Builder).Append(1)
+	builder.Field(1).(*array.TimestampBuilder).Append(1_000)
+	builder.Field(2).(*array.Decimal256Builder).Append(decimal256.FromI64(12345))
+	rec := builder.NewRecord()
+	builder.Release()
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.DeleteRecord(ctx, &message.WriteDeleteRecord{DeleteRecord: message.DeleteRecord{
+		TableName: table.Name,
+		WhereClause: message.PredicateGroups{{
+			GroupingType: "AND",
+			Predicates:   message.Predicates{{Operator: "eq", Column: "created_at", Record: rec}},
+		}},
+	}}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	wantTimestamp := &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	wantDecimal := &arrow.Decimal128Type{Precision: 38, Scale: 2}
+	migrated := server.migratedSchema(t, table.Name)
+	assert.True(t, arrow.TypeEqual(wantTimestamp, migrated.Field(1).Type))
+	assert.True(t, arrow.TypeEqual(wantDecimal, migrated.Field(2).Type))
+
+	require.Len(t, server.records[table.Name], 1)
+	written := server.records[table.Name][0]
+	assert.Equal(t, arrow.Timestamp(1), written.Column(1).(*array.Timestamp).Value(0))
+	assert.Equal(t, decimal128.FromI64(12345), written.Column(2).(*array.Decimal128).Value(0))
+
+	action := server.actions[len(server.actions)-1]
+	require.Equal(t, deleteRecord, action.GetType())
+	var msg pb.Write_MessageDeleteRecord
+	require.NoError(t, proto.Unmarshal(action.GetBody(), &msg))
+	predicate, err := pb.NewRecordFromBytes(msg.WhereClause[0].Predicates[0].Record)
+	require.NoError(t, err)
+	defer predicate.Release()
+	assert.True(t, arrow.TypeEqual(wantTimestamp, predicate.Column(1).DataType()))
+	assert.True(t, arrow.TypeEqual(wantDecimal, predicate.Column(2).DataType()))
+}
@@ -11,18 +11,31 @@ import (
 )
 
 func (c *Client) Read(ctx context.Context, table *schema.Table, res chan<- arrow.Record) error {
+	if len(c.targets) > 0 {
+		return c.readTargets(ctx, table, res)
+	}
+
+	if !c.includeTable(table.Name) {
+		c.logger.Debug().Str("table", table.Name).Msg("table is excluded, skipping read")
+		return nil
+	}
 	c.logger.Debug().Str("table", table.Name).Msg("read")
-	flightInfo, err := c.getFlightInfo(ctx, table.Name)
+	tableName := c.namer.tableName(table.Name)
+	flightInfo, err := c.getFlightInfo(ctx, tableName)
 	if err != nil {
 		return fmt.Errorf("failed to get flight info: %w", err)
 	}
 	var reader *ipc.Reader
-	if reader, err = ipc.NewReader(bytes.NewReader(flightInfo.GetSchema())); err != nil {
+	if reader, err = ipc.NewReader(bytes.NewReader(flightInfo.GetSchema()), ipc.WithAllocator(c.allocator)); err != nil {
 		return fmt.Errorf("failed to create reader: %w", err)
 	}
 	defer reader.Release()
+	var restore recordConverter
+	if restore, err = c.readConverter(table); err != nil {
+		return err
+	}
 	for _, endpoint := range flightInfo.GetEndpoint() {
-		if err = c.doGet(ctx, endpoint, reader.Schema(), res); err != nil {
+		if err = c.doGet(ctx, tableName, endpoint, reader.Schema(), restore, res); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+const (
+	// ipcMessageOverhead bounds the size of the IPC message header, continuation marker and flight data framing.
+	ipcMessageOverhead = 512
+	// ipcFieldNodeOverhead is the size of a field node in the record batch header.
+	ipcFieldNodeOverhead = 16
+	// ipcBufferOverhead is the size of a buffer description in the record batch header.
+	ipcBufferOverhead = 16
+	// ipcAlignment is the alignment of every buffer in the record batch body.
+	ipcAlignment = 8
+)
+
+func (c *Client) recordSize(rec arrow.Record) (int, error) {
+	if c.spec.RecordSizeMode == spec.RecordSizeModeExact {
+		return exactRecordSize(rec, c.allocator)
+	}
+	return estimateRecordSize(rec), nil
+}
+
+// estimateRecordSize returns an upper bound of the size of the record once serialized, computed from
+// the lengths of its buffers plus the IPC overhead. Buffers of sliced arrays are counted in full.
+func estimateRecordSize(rec arrow.Record) int {
+	size := ipcMessageOverhead
+	for _, column := range rec.Columns() {
+		size += arrayDataSize(column.Data())
+	}
+	return size
+}
+
+func arrayDataSize(data arrow.ArrayData) int {
+	size := ipcFieldNodeOverhead
+	for _, buffer := range data.Buffers() {
+		size += ipcBufferOverhead
+		if buffer != nil {
+			size += paddedLength(buffer.Len())
+		}
+	}
+	for _, child := range data.Children() {
+		size += arrayDataSize(child)
+	}
+	if data.DataType().ID() == arrow.DICTIONARY {
+		size += ipcMessageOverhead + arrayDataSize(data.Dictionary())
+	}
+	return size
+}
+
+func paddedLength(length int) int {
+	return (length + ipcAlignment - 1) / ipcAlignment * ipcAlignment
+}
+
+// exactRecordSize serializes the record to measure its size.
+func exactRecordSize(rec arrow.Record, mem memory.Allocator) (int, error) {
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()), ipc.WithAllocator(mem))
+	defer func(writer *ipc.Writer) {
+		_ = writer.Close()
+	}(writer)
+	if err := writer.Write(rec); err != nil {
+		return -1, fmt.Errorf("failed to write record: %w", err)
+	}
+	return buf.Len(), nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecordSizeTables() map[string]*schema.Table {
+	return map[string]*schema.Table{
+		"narrow": testTable("test_narrow"),
+		"wide": schema.TestTable("test_wide", schema.TestSourceOptions{
+			SkipLists:   true,
+			SkipMaps:    true,
+			SkipStructs: true,
+		}),
+		"nested": schema.TestTable("test_nested", schema.TestSourceOptions{}),
+	}
+}
+
+func testRecordSizeRecord(table *schema.Table, rows int) arrow.Record {
+	return schema.NewTestDataGenerator(0).Generate(table, schema.GenTestDataOptions{
+		SourceName:    "test",
+		SyncTime:      time.Now(),
+		MaxRows:       rows,
+		TimePrecision: time.Nanosecond,
+	})
+}
+
+func TestEstimateRecordSize(t *testing.T) {
+	for name, table := range testRecordSizeTables() {
+		for _, rows := range []int{0, 1, 100} {
+			t.Run(fmt.Sprintf("%s/%d", name, rows), func(t *testing.T) {
+				rec := testRecordSizeRecord(table, rows)
+				defer rec.Release()
+
+				exact, err := exactRecordSize(rec, memory.DefaultAllocator)
+				require.NoError(t, err)
+				// The exact size also contains the schema message which is sent only once per stream.
+				empty := rec.NewSlice(0, 0)
+				defer empty.Release()
+				schemaSize, err := exactRecordSize(empty, memory.DefaultAllocator)
+				require.NoError(t, err)
+
+				assert.GreaterOrEqual(t, estimateRecordSize(rec), exact-schemaSize)
+			})
+		}
+	}
+}
+
+func BenchmarkRecordSize(b *testing.B) {
+	for name, table := range testRecordSizeTables() {
+		rec := testRecordSizeRecord(table, 1000)
+		b.Run(name+"/exact", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := exactRecordSize(rec, memory.DefaultAllocator); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/estimate", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				estimateRecordSize(rec)
+			}
+		})
+		rec.Release()
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// router resolves the targets of a table from the routes of the spec. The targets of a table are resolved once,
+// so inserts, migrations, deletes and reads of a table always go to the same targets. A nil router sends every
+// table to every target.
+type router struct {
+	routes  []spec.Route
+	targets map[string]int
+
+	mutex  sync.Mutex
+	tables map[string][]int
+}
+
+// newRouter returns a router for the connected targets, or nil if there are no routes.
+func newRouter(routes []spec.Route, targets []*target) *router {
+	if len(routes) == 0 {
+		return nil
+	}
+	r := &router{
+		routes:  routes,
+		targets: make(map[string]int, len(targets)),
+		tables:  make(map[string][]int),
+	}
+	for i, t := range targets {
+		r.targets[t.name] = i
+	}
+	return r
+}
+
+// resolve returns the indexes of the targets of the table. A route matching the source name can't be resolved
+// without it, so resolve reports false unless final is set, in which case such routes are ignored. A resolution
+// which ignored such a route isn't kept, as a later message carrying the source name may resolve differently.
+// A table routed to a target which isn't connected has no targets.
+func (r *router) resolve(tableName, sourceName string, final bool) ([]int, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if indexes, ok := r.tables[tableName]; ok {
+		return indexes, true
+	}
+
+	indexes, found, skipped := []int(nil), false, false
+	for _, route := range r.routes {
+		if !route.MatchTable(tableName) {
+			continue
+		}
+		if len(route.SourceName) > 0 && len(sourceName) == 0 {
+			if !final {
+				return nil, false
+			}
+			skipped = true
+			continue
+		}
+		if !route.MatchSourceName(sourceName) {
+			continue
+		}
+		if index, ok := r.targets[route.Target]; ok {
+			indexes = []int{index}
+		}
+		found = true
+		break
+	}
+	if !found {
+		indexes = make([]int, len(r.targets))
+		for _, index := range r.targets {
+			indexes[index] = index
+		}
+	}
+	if !skipped {
+		r.tables[tableName] = indexes
+	}
+	return indexes, true
+}
+
+// routeKey returns the table and source name a message is routed by. Messages which don't concern a single table
+// are sent to every target.
+func routeKey(msg message.WriteMessage) (tableName, sourceName string, ok bool) {
+	switch msg := msg.(type) {
+	case *message.WriteMigrateTable:
+		return msg.Table.Name, "", true
+	case *message.WriteInsert:
+		tableName, found := msg.Record.Schema().Metadata().GetValue(schema.MetadataTableName)
+		if !found {
+			return "", "", false
+		}
+		return tableName, stringValue(msg.Record, schema.CqSourceNameColumn.Name), true
+	case *message.WriteDeleteStale:
+		return msg.TableName, msg.SourceName, true
+	case *message.WriteDeleteRecord:
+		return msg.TableName, "", true
+	default:
+		return "", "", false
+	}
+}
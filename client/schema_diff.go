@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// metadataTableChanges is added to the schema metadata sent with MigrateTable when the server already knows the table.
+	metadataTableChanges = "cq:table_changes"
+
+	changeAddColumn              = "add_column"
+	changeDropColumn             = "drop_column"
+	changeUpdateColumn           = "change_column"
+	changeRemoveUniqueConstraint = "remove_unique_constraint"
+	changeMovePKToCQOnly         = "move_pk_to_cq_id"
+)
+
+// tableChange is a single change between the table known by the server and the table being migrated.
+type tableChange struct {
+	Type     string            `json:"type"`
+	Column   string            `json:"column,omitempty"`
+	Current  *columnDefinition `json:"current,omitempty"`
+	Previous *columnDefinition `json:"previous,omitempty"`
+}
+
+// getTable returns the table as known by the server. It returns nil if the server doesn't know the table
+// or doesn't implement GetSchema. The call is limited by the timeout of the MigrateTable action it precedes.
+func (c *Client) getTable(ctx context.Context, tableName string) (*schema.Table, error) {
+	timeout := c.spec.Timeouts.ActionTimeout(migrateTable)
+	schemaCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	result, err := c.flightClient.GetSchema(schemaCtx, c.flightDescriptor(tableName))
+	if code := status.Code(err); code == codes.NotFound || code == codes.Unimplemented {
+		c.logger.Debug().Str("tableName", tableName).Str("code", code.String()).Msg("no schema for table")
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get schema: %w", timeoutError(ctx, schemaCtx, err, operationGetSchema, tableName, timeout))
+	}
+
+	var sc *arrow.Schema
+	if sc, err = flight.DeserializeSchema(result.GetSchema(), c.allocator); err != nil {
+		return nil, fmt.Errorf("failed to deserialize schema: %w", err)
+	}
+	var table *schema.Table
+	if table, err = schema.NewTableFromArrowSchema(sc); err != nil {
+		return nil, fmt.Errorf("failed to read table from schema: %w", err)
+	}
+	return table, nil
+}
+
+func newTableChanges(changes []schema.TableColumnChange) []tableChange {
+	tableChanges := make([]tableChange, len(changes))
+	for i, change := range changes {
+		tableChange := tableChange{
+			Column: change.ColumnName,
+		}
+		switch change.Type {
+		case schema.TableColumnChangeTypeAdd:
+			tableChange.Type = changeAddColumn
+		case schema.TableColumnChangeTypeRemove:
+			tableChange.Type = changeDropColumn
+		case schema.TableColumnChangeTypeUpdate:
+			tableChange.Type = changeUpdateColumn
+		case schema.TableColumnChangeTypeRemoveUniqueConstraint:
+			tableChange.Type = changeRemoveUniqueConstraint
+		case schema.TableColumnChangeTypeMoveToCQOnly:
+			tableChange.Type = changeMovePKToCQOnly
+		default:
+			tableChange.Type = change.Type.String()
+		}
+		if change.Current.Name != "" {
+			current := newColumnDefinition(change.Current)
+			tableChange.Current = &current
+		}
+		if change.Previous.Name != "" {
+			previous := newColumnDefinition(change.Previous)
+			tableChange.Previous = &previous
+		}
+		tableChanges[i] = tableChange
+	}
+	return tableChanges
+}
+
+func marshalTableChanges(changes []schema.TableColumnChange) (string, error) {
+	b, err := json.Marshal(newTableChanges(changes))
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal table changes: %w", err)
+	}
+	return string(b), nil
+}
+
+// unsafeChanges returns the changes which can lose data or break the primary key and thus require a forced migration.
+func unsafeChanges(changes []schema.TableColumnChange) []schema.TableColumnChange {
+	var moveToCQOnly bool
+	for _, change := range changes {
+		if change.Type == schema.TableColumnChangeTypeMoveToCQOnly {
+			moveToCQOnly = true
+		}
+	}
+
+	var unsafe []schema.TableColumnChange
+	for _, change := range changes {
+		if !isSafeChange(change, moveToCQOnly) {
+			unsafe = append(unsafe, change)
+		}
+	}
+	return unsafe
+}
+
+func isSafeChange(change schema.TableColumnChange, moveToCQOnly bool) bool {
+	switch change.Type {
+	case schema.TableColumnChangeTypeAdd:
+		return !change.Current.PrimaryKey || (moveToCQOnly && change.ColumnName == schema.CqIDColumn.Name)
+	case schema.TableColumnChangeTypeRemove:
+		return !change.Previous.PrimaryKey || moveToCQOnly
+	case schema.TableColumnChangeTypeRemoveUniqueConstraint, schema.TableColumnChangeTypeMoveToCQOnly:
+		return true
+	case schema.TableColumnChangeTypeUpdate:
+		// Moving the primary key to _cq_id only changes the primary key flags of the columns.
+		return moveToCQOnly && arrow.TypeEqual(change.Current.Type, change.Previous.Type)
+	default:
+		return false
+	}
+}
+
+func describeChanges(changes []schema.TableColumnChange) string {
+	descriptions := make([]string, len(changes))
+	for i, change := range changes {
+		descriptions[i] = change.String()
+	}
+	return strings.Join(descriptions, "; ")
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pb "github.com/cloudquery/plugin-pb-go/pb/plugin/v3"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMigrateTable_SchemaDiff(t *testing.T) {
+	withColumn := func(column schema.Column) *schema.Table {
+		table := testTable("test_table")
+		table.Columns = append(table.Columns, column)
+		return table
+	}
+
+	tests := []struct {
+		name        string
+		previous    *schema.Table
+		table       *schema.Table
+		migrateMode string
+		wantSkip    bool
+		wantChanges []tableChange
+		wantForce   bool
+		wantErr     string
+	}{
+		{
+			name:  "should migrate a new table",
+			table: testTable("test_table"),
+		},
+		{
+			name:     "should skip an unchanged table",
+			previous: testTable("test_table"),
+			table:    testTable("test_table"),
+			wantSkip: true,
+		},
+		{
+			name:     "should send safe changes",
+			previous: testTable("test_table"),
+			table:    withColumn(schema.Column{Name: "region", Type: arrow.BinaryTypes.String}),
+			wantChanges: []tableChange{
+				{Type: changeAddColumn, Column: "region", Current: &columnDefinition{Name: "region", Type: "utf8"}},
+			},
+		},
+		{
+			name:     "should refuse unsafe changes",
+			previous: withColumn(schema.Column{Name: "size", Type: arrow.PrimitiveTypes.Int32}),
+			table:    withColumn(schema.Column{Name: "size", Type: arrow.PrimitiveTypes.Int64}),
+			wantErr:  "table test_table requires unsafe changes",
+		},
+		{
+			name:        "should force unsafe changes",
+			previous:    withColumn(schema.Column{Name: "size", Type: arrow.PrimitiveTypes.Int32}),
+			table:       withColumn(schema.Column{Name: "size", Type: arrow.PrimitiveTypes.Int64}),
+			migrateMode: "forced",
+			wantChanges: []tableChange{
+				{
+					Type:     changeUpdateColumn,
+					Column:   "size",
+					Current:  &columnDefinition{Name: "size", Type: "int64"},
+					Previous: &columnDefinition{Name: "size", Type: "int32"},
+				},
+			},
+			wantForce: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			if tt.previous != nil {
+				server.schemas[tt.previous.Name] = tt.previous.ToArrowSchema()
+			}
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"migrate_mode": tt.migrateMode})
+			defer func() {
+				require.NoError(t, c.Close(context.Background()))
+			}()
+
+			err := c.MigrateTable(context.Background(), &message.WriteMigrateTable{Table: tt.table})
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				assert.NotContains(t, server.actionTypes(), migrateTable)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.wantSkip {
+				assert.NotContains(t, server.actionTypes(), migrateTable)
+				return
+			}
+			action := server.actions[len(server.actions)-1]
+			require.Equal(t, migrateTable, action.GetType())
+
+			var msg pb.Write_MessageMigrateTable
+			require.NoError(t, proto.Unmarshal(action.GetBody(), &msg))
+			assert.Equal(t, tt.wantForce, msg.MigrateForce)
+
+			sc, err := flight.DeserializeSchema(msg.Table, memory.DefaultAllocator)
+			require.NoError(t, err)
+			i := sc.Metadata().FindKey(metadataTableChanges)
+			if tt.wantChanges == nil {
+				assert.Equal(t, -1, i)
+				return
+			}
+			require.GreaterOrEqual(t, i, 0)
+			var got []tableChange
+			require.NoError(t, json.Unmarshal([]byte(sc.Metadata().Values()[i]), &got))
+			assert.Equal(t, tt.wantChanges, got)
+		})
+	}
+}
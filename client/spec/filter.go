@@ -0,0 +1,81 @@
+package spec
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IncludeTable reports whether the table is written to the ArrowFlight service according to
+// `include_tables` and `exclude_tables`.
+func (s *Spec) IncludeTable(tableName string) bool {
+	if len(s.IncludeTables) > 0 && !matchAny(s.IncludeTables, tableName) {
+		return false
+	}
+	return !matchAny(s.ExcludeTables, tableName)
+}
+
+// IncludeColumn reports whether the column of the table is written to the ArrowFlight service according to
+// `include_columns` and `exclude_columns`.
+func (s *Spec) IncludeColumn(tableName, columnName string) bool {
+	included, filtered := false, false
+	for _, pattern := range s.IncludeColumns {
+		tablePattern, _, _ := strings.Cut(pattern, ".")
+		if ok, _ := path.Match(tablePattern, tableName); !ok {
+			continue
+		}
+		filtered = true
+		if matchColumn(pattern, tableName, columnName) {
+			included = true
+			break
+		}
+	}
+	if filtered && !included {
+		return false
+	}
+	for _, pattern := range s.ExcludeColumns {
+		if matchColumn(pattern, tableName, columnName) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchColumn reports whether the `<table>.<column>` pattern matches the column of the table.
+func matchColumn(pattern, tableName, columnName string) bool {
+	tablePattern, columnPattern, _ := strings.Cut(pattern, ".")
+	tableMatch, _ := path.Match(tablePattern, tableName)
+	columnMatch, _ := path.Match(columnPattern, columnName)
+	return tableMatch && columnMatch
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTablePatterns(name string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("`%s` contains an invalid pattern %q: %w", name, pattern, err)
+		}
+	}
+	return nil
+}
+
+func validateColumnPatterns(name string, patterns []string) error {
+	for _, pattern := range patterns {
+		tablePattern, columnPattern, found := strings.Cut(pattern, ".")
+		if !found || len(tablePattern) == 0 || len(columnPattern) == 0 {
+			return fmt.Errorf("`%s` contains the pattern %q, which isn't of the form `<table>.<column>`", name, pattern)
+		}
+		if err := validateTablePatterns(name, []string{tablePattern, columnPattern}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package spec
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/v4/configtype"
+)
+
+// minKeepaliveTime is the shortest keepalive interval gRPC accepts.
+const minKeepaliveTime = 10 * time.Second
+
+// Keepalive configures the gRPC keepalive pings, which detect connections dropped by load balancers or proxies.
+type Keepalive struct {
+	// How long the connection may be idle before a ping is sent, e.g. `60s`. It must be at least `10s`.
+	// Pings are disabled if this is not set. The ArrowFlight service must permit pings this often, otherwise it closes the connection.
+	Time configtype.Duration `json:"time,omitempty"`
+
+	// How long to wait for the acknowledgement of a ping before the connection is closed. gRPC defaults to `20s`.
+	Timeout configtype.Duration `json:"timeout,omitempty"`
+
+	// Send pings even if there are no active calls, e.g. between the writes of a sync.
+	PermitWithoutStream bool `json:"permit_without_stream,omitempty"`
+}
+
+func (k *Keepalive) Validate() error {
+	if k.Time.Duration() < 0 || k.Timeout.Duration() < 0 {
+		return errors.New("`keepalive.time` and `keepalive.timeout` must not be negative")
+	}
+	if k.Time.Duration() > 0 && k.Time.Duration() < minKeepaliveTime {
+		return errors.New("`keepalive.time` must be at least 10s")
+	}
+	if k.Time.Duration() == 0 && (k.Timeout.Duration() > 0 || k.PermitWithoutStream) {
+		return errors.New("`keepalive.timeout` and `keepalive.permit_without_stream` require `keepalive.time`")
+	}
+	return nil
+}
+
+// Backoff configures the delay between attempts to connect to an address of the ArrowFlight service.
+// Unset values keep the gRPC defaults.
+type Backoff struct {
+	// The delay after the first failed attempt. gRPC defaults to `1s`.
+	BaseDelay configtype.Duration `json:"base_delay,omitempty"`
+
+	// The factor the delay is multiplied with after each failed attempt. gRPC defaults to `1.6`.
+	Multiplier float64 `json:"multiplier,omitempty" jsonschema:"minimum=1"`
+
+	// The fraction the delays are randomized by. gRPC defaults to `0.2`.
+	Jitter float64 `json:"jitter,omitempty" jsonschema:"minimum=0,maximum=1"`
+
+	// The upper bound of the delay. gRPC defaults to `120s`.
+	MaxDelay configtype.Duration `json:"max_delay,omitempty"`
+}
+
+func (b *Backoff) Validate() error {
+	if b.BaseDelay.Duration() < 0 || b.MaxDelay.Duration() < 0 {
+		return errors.New("`backoff.base_delay` and `backoff.max_delay` must not be negative")
+	}
+	if b.Multiplier != 0 && b.Multiplier < 1 {
+		return errors.New("`backoff.multiplier` must be at least 1")
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		return errors.New("`backoff.jitter` must be between 0 and 1")
+	}
+	if b.BaseDelay.Duration() > 0 && b.MaxDelay.Duration() > 0 && b.MaxDelay.Duration() < b.BaseDelay.Duration() {
+		return errors.New("`backoff.max_delay` must not be less than `backoff.base_delay`")
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	NamingConventionNone  = "none"
+	NamingConventionSnake = "snake"
+	NamingConventionCamel = "camel"
+	NamingConventionUpper = "upper"
+)
+
+// Naming maps the CloudQuery table and column names to the names the ArrowFlight service stores.
+type Naming struct {
+	// Explicit table names, keyed by the CloudQuery table name. They take precedence over `table_convention`.
+	Tables map[string]string `json:"tables,omitempty"`
+
+	// The convention the table names are converted to: `none`, `snake` (`aws_s3_buckets`), `camel` (`awsS3Buckets`) or `upper` (`AWS_S3_BUCKETS`).
+	TableConvention string `json:"table_convention,omitempty" jsonschema:"enum=none,enum=snake,enum=camel,enum=upper,default=none"`
+
+	// Explicit column names, keyed by the CloudQuery column name or by `<table>.<column>`, which takes precedence.
+	// They take precedence over `strip_prefixes` and `column_convention`.
+	Columns map[string]string `json:"columns,omitempty"`
+
+	// The convention the column names are converted to: `none`, `snake`, `camel` or `upper`.
+	ColumnConvention string `json:"column_convention,omitempty" jsonschema:"enum=none,enum=snake,enum=camel,enum=upper,default=none"`
+
+	// Prefixes stripped from the column names before `column_convention` is applied, e.g. `_cq_`.
+	StripPrefixes []string `json:"strip_prefixes,omitempty" jsonschema:"example=_cq_"`
+}
+
+func (n *Naming) SetDefaults() {
+	if len(n.TableConvention) == 0 {
+		n.TableConvention = NamingConventionNone
+	}
+	if len(n.ColumnConvention) == 0 {
+		n.ColumnConvention = NamingConventionNone
+	}
+}
+
+func (n *Naming) Validate() error {
+	conventions := []string{NamingConventionNone, NamingConventionSnake, NamingConventionCamel, NamingConventionUpper}
+	switch n.TableConvention {
+	case "", NamingConventionNone, NamingConventionSnake, NamingConventionCamel, NamingConventionUpper:
+	default:
+		return fmt.Errorf("`naming.table_convention` must be one of %q", conventions)
+	}
+	switch n.ColumnConvention {
+	case "", NamingConventionNone, NamingConventionSnake, NamingConventionCamel, NamingConventionUpper:
+	default:
+		return fmt.Errorf("`naming.column_convention` must be one of %q", conventions)
+	}
+	for name, renamed := range n.Tables {
+		if len(renamed) == 0 {
+			return fmt.Errorf("`naming.tables` must not map table %q to an empty name", name)
+		}
+	}
+	for name, renamed := range n.Columns {
+		if len(renamed) == 0 {
+			return fmt.Errorf("`naming.columns` must not map column %q to an empty name", name)
+		}
+	}
+	for _, prefix := range n.StripPrefixes {
+		if len(prefix) == 0 {
+			return errors.New("`naming.strip_prefixes` must not contain empty prefixes")
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether any table or column is renamed.
+func (n *Naming) Enabled() bool {
+	return len(n.Tables) > 0 || len(n.Columns) > 0 || len(n.StripPrefixes) > 0 ||
+		(len(n.TableConvention) > 0 && n.TableConvention != NamingConventionNone) ||
+		(len(n.ColumnConvention) > 0 && n.ColumnConvention != NamingConventionNone)
+}
+
+// TableName returns the name the ArrowFlight service stores the table under.
+func (n *Naming) TableName(tableName string) string {
+	if renamed, ok := n.Tables[tableName]; ok {
+		return renamed
+	}
+	return convertName(n.TableConvention, tableName)
+}
+
+// ColumnName returns the name the ArrowFlight service stores the column of the table under.
+func (n *Naming) ColumnName(tableName, columnName string) string {
+	if renamed, ok := n.Columns[tableName+"."+columnName]; ok {
+		return renamed
+	}
+	if renamed, ok := n.Columns[columnName]; ok {
+		return renamed
+	}
+	for _, prefix := range n.StripPrefixes {
+		if stripped, ok := strings.CutPrefix(columnName, prefix); ok && len(stripped) > 0 {
+			columnName = stripped
+			break
+		}
+	}
+	return convertName(n.ColumnConvention, columnName)
+}
+
+// convertName converts the name to the convention. Leading underscores are kept, except for `camel`.
+func convertName(convention, name string) string {
+	trimmed := strings.TrimLeft(name, "_")
+	leading := name[:len(name)-len(trimmed)]
+	words := splitWords(trimmed)
+	if len(words) == 0 {
+		return name
+	}
+	switch convention {
+	case NamingConventionSnake:
+		return leading + strings.ToLower(strings.Join(words, "_"))
+	case NamingConventionUpper:
+		return leading + strings.ToUpper(strings.Join(words, "_"))
+	case NamingConventionCamel:
+		var b strings.Builder
+		for i, word := range words {
+			word = strings.ToLower(word)
+			if i > 0 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			b.WriteString(word)
+		}
+		return b.String()
+	default:
+		return name
+	}
+}
+
+// splitWords splits the name at underscores, hyphens and spaces, and where a lower case letter or digit
+// is followed by an upper case letter. Acronyms are kept together, e.g. `accountIDName` is split into
+// `account`, `ID` and `Name`.
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == ' ' {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			previous := word[len(word)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(previous) || nextLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
@@ -0,0 +1,70 @@
+package spec
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	TimestampUnitSecond      = "s"
+	TimestampUnitMillisecond = "ms"
+	TimestampUnitMicrosecond = "us"
+	TimestampUnitNanosecond  = "ns"
+
+	// TimestampTimezoneNone removes the timezone of timestamp columns.
+	TimestampTimezoneNone = "none"
+
+	PrecisionLossError    = "error"
+	PrecisionLossTruncate = "truncate"
+)
+
+// Normalization rewrites timestamps and decimals to the units and precisions the ArrowFlight service stores.
+type Normalization struct {
+	// The unit of the timestamp columns. If this is not set, the unit is kept.
+	TimestampUnit string `json:"timestamp_unit,omitempty" jsonschema:"enum=s,enum=ms,enum=us,enum=ns"`
+
+	// The timezone of the timestamp columns, e.g. `UTC`, or `none` to remove the timezone.
+	// Timestamps are stored as instants since the Unix epoch, so only the type changes. If this is not set, the timezone is kept.
+	TimestampTimezone string `json:"timestamp_timezone,omitempty" jsonschema:"example=UTC"`
+
+	// The maximum precision of the decimal columns. Decimals with a higher precision are capped, and written as
+	// `decimal128` if the precision is at most 38. If this is not set, the precision is kept.
+	DecimalMaxPrecision int32 `json:"decimal_max_precision,omitempty" jsonschema:"minimum=1,maximum=76"`
+
+	// This parameter is used to select what happens when a value loses precision, e.g. nanoseconds written as microseconds.
+	// `error` fails the write, `truncate` truncates the value and logs a warning. Values which overflow always fail the write.
+	PrecisionLoss string `json:"precision_loss,omitempty" jsonschema:"enum=error,enum=truncate,default=error"`
+}
+
+func (n *Normalization) SetDefaults() {
+	if len(n.PrecisionLoss) == 0 {
+		n.PrecisionLoss = PrecisionLossError
+	}
+}
+
+func (n *Normalization) Validate() error {
+	switch n.TimestampUnit {
+	case "", TimestampUnitSecond, TimestampUnitMillisecond, TimestampUnitMicrosecond, TimestampUnitNanosecond:
+	default:
+		return fmt.Errorf("`normalization.timestamp_unit` must be one of %q", []string{TimestampUnitSecond, TimestampUnitMillisecond, TimestampUnitMicrosecond, TimestampUnitNanosecond})
+	}
+	if len(n.TimestampTimezone) > 0 && n.TimestampTimezone != TimestampTimezoneNone {
+		if _, err := time.LoadLocation(n.TimestampTimezone); err != nil {
+			return fmt.Errorf("invalid `normalization.timestamp_timezone`: %w", err)
+		}
+	}
+	if n.DecimalMaxPrecision < 0 || n.DecimalMaxPrecision > 76 {
+		return fmt.Errorf("`normalization.decimal_max_precision` must be between 1 and 76")
+	}
+	switch n.PrecisionLoss {
+	case "", PrecisionLossError, PrecisionLossTruncate:
+	default:
+		return fmt.Errorf("`normalization.precision_loss` must be one of %q or %q", PrecisionLossError, PrecisionLossTruncate)
+	}
+	return nil
+}
+
+// Enabled reports whether any normalization is set.
+func (n *Normalization) Enabled() bool {
+	return len(n.TimestampUnit) > 0 || len(n.TimestampTimezone) > 0 || n.DecimalMaxPrecision > 0
+}
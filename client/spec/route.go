@@ -0,0 +1,69 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// Route sends the tables it matches to a single target.
+type Route struct {
+	// Glob patterns of the table names matched by the route, e.g. `aws_*`. An empty list matches every table.
+	Tables []string `json:"tables,omitempty" jsonschema:"example=aws_*"`
+
+	// Glob pattern of the source name matched by the route, e.g. `aws`. If this is not set, every source is matched.
+	// The route is ignored for reads and for tables whose records don't carry a source name.
+	SourceName string `json:"source_name,omitempty"`
+
+	// The name of the target receiving the matched tables.
+	Target string `json:"target" jsonschema:"required,minLength=1"`
+}
+
+func (r *Route) Validate(targets []Target) error {
+	if len(r.Target) == 0 {
+		return errors.New("`target` is required")
+	}
+	if !r.hasTarget(targets) {
+		return fmt.Errorf("unknown target %q", r.Target)
+	}
+	for _, pattern := range r.Tables {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+	}
+	if _, err := path.Match(r.SourceName, ""); err != nil {
+		return fmt.Errorf("invalid source name pattern %q: %w", r.SourceName, err)
+	}
+	return nil
+}
+
+func (r *Route) hasTarget(targets []Target) bool {
+	for _, target := range targets {
+		if target.Name == r.Target {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTable reports whether the route matches the table name.
+func (r *Route) MatchTable(tableName string) bool {
+	if len(r.Tables) == 0 {
+		return true
+	}
+	for _, pattern := range r.Tables {
+		if ok, _ := path.Match(pattern, tableName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchSourceName reports whether the route matches the source name.
+func (r *Route) MatchSourceName(sourceName string) bool {
+	if len(r.SourceName) == 0 {
+		return true
+	}
+	ok, _ := path.Match(r.SourceName, sourceName)
+	return ok
+}
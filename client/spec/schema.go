@@ -2,7 +2,17 @@ package spec
 
 import (
 	_ "embed"
+
+	"github.com/invopop/jsonschema"
 )
 
 //go:embed schema.json
 var JSONSchema string
+
+// JSONSchemaExtend requires either `addr` or `targets`.
+func (Spec) JSONSchemaExtend(sc *jsonschema.Schema) {
+	sc.OneOf = []*jsonschema.Schema{
+		{Required: []string{"addr"}},
+		{Required: []string{"targets"}},
+	}
+}
@@ -2,16 +2,69 @@ package spec
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudquery/plugin-sdk/v4/configtype"
+)
+
+const (
+	defaultMaxCallRecvMsgSize    = 4000000
+	defaultMaxCallSendMsgSize    = 2147483647
+	defaultExchangeWindowSize    = 64
+	defaultDeleteRecordBatchSize = 1
+)
+
+// defaultDescriptorPath is the path of the flight descriptors, followed by the table name.
+var defaultDescriptorPath = []string{"cloudquery", "arrowflight"}
+
+const (
+	WriteTransportDoPut      = "do_put"
+	WriteTransportDoExchange = "do_exchange"
+)
+
+const (
+	WriteModeAppend               = "append"
+	WriteModeOverwrite            = "overwrite"
+	WriteModeOverwriteDeleteStale = "overwrite-delete-stale"
 )
 
 const (
-	defaultMaxCallRecvMsgSize = 4000000
-	defaultMaxCallSendMsgSize = 2147483647
+	MigrateModeSafe   = "safe"
+	MigrateModeForced = "forced"
+)
+
+const (
+	LoadBalancingPolicyPickFirst  = "pick_first"
+	LoadBalancingPolicyRoundRobin = "round_robin"
+)
+
+const (
+	RecordSizeModeEstimate = "estimate"
+	RecordSizeModeExact    = "exact"
+)
+
+const (
+	NestedColumnsKeep    = "keep"
+	NestedColumnsFlatten = "flatten"
+	NestedColumnsJSON    = "json"
 )
 
 type Spec struct {
 	// The address of the ArrowFlight service.
-	Addr string `json:"addr,omitempty" jsonschema:"required,minLength=1,example=localhost:9090"`
+	// A comma-separated list of addresses, or a gRPC target such as `dns:///flight.example.com:9090` resolving to several
+	// addresses, enables failover between the nodes of the ArrowFlight service.
+	// Either `addr` or `targets` is required.
+	Addr string `json:"addr,omitempty" jsonschema:"minLength=1,example=localhost:9090"`
+
+	// This parameter is used to select how calls are spread over the addresses of the ArrowFlight service.
+	// `pick_first` sends every call to the first reachable address and fails over to the next one, `round_robin` spreads
+	// the calls over all reachable addresses.
+	LoadBalancingPolicy string `json:"load_balancing_policy,omitempty" jsonschema:"enum=pick_first,enum=round_robin,default=pick_first"`
+
+	// This parameter is used to enable gRPC health checks (`grpc.health.v1.Health`) of the addresses with the `round_robin` policy.
+	// Unhealthy addresses don't receive calls until they report to be serving again.
+	HealthCheck bool `json:"health_check,omitempty"`
 
 	// This parameter is used to authenticate with the ArrowFlight service during the handshake.
 	Handshake string `json:"handshake,omitempty"`
@@ -33,6 +86,132 @@ type Spec struct {
 
 	// This parameter is used to skip the verification of the server's certificate chain and host name.
 	TlsInsecureSkipVerify bool `json:"tls_insecure_skip_verify,omitempty"`
+
+	// This parameter is used to select the transport used to stream records to the ArrowFlight service.
+	// `do_put` streams records with DoPut, `do_exchange` streams records with DoExchange and expects the service to acknowledge every batch.
+	WriteTransport string `json:"write_transport,omitempty" jsonschema:"enum=do_put,enum=do_exchange,default=do_put"`
+
+	// This parameter is used to set the maximum number of unacknowledged batches kept per table for resending after a reconnect.
+	// Only used with the `do_exchange` write transport.
+	ExchangeWindowSize int `json:"exchange_window_size,omitempty" jsonschema:"minimum=1,default=64"`
+
+	// This parameter is used to limit the number of batches across all tables which were sent but not yet acknowledged by the ArrowFlight service.
+	// A batch is acknowledged by a `PutResult` (or an ack when using the `do_exchange` write transport). Inserts block once the limit is reached.
+	// If this is not set, the number of batches in flight is not limited.
+	MaxInFlightBatches int `json:"max_in_flight_batches,omitempty" jsonschema:"minimum=0"`
+
+	// This parameter is used to limit the size in bytes of the batches across all tables which were sent but not yet acknowledged by the ArrowFlight service.
+	// If this is not set, the number of bytes in flight is not limited.
+	MaxInFlightBytes int64 `json:"max_in_flight_bytes,omitempty" jsonschema:"minimum=0"`
+
+	// This parameter is used to limit the number of batches per table which were sent but not yet acknowledged by the ArrowFlight service.
+	// If this is not set, the number of batches in flight is not limited.
+	MaxTableInFlightBatches int `json:"max_table_in_flight_batches,omitempty" jsonschema:"minimum=0"`
+
+	// This parameter is used to limit the size in bytes of the batches per table which were sent but not yet acknowledged by the ArrowFlight service.
+	// If this is not set, the number of bytes in flight is not limited.
+	MaxTableInFlightBytes int64 `json:"max_table_in_flight_bytes,omitempty" jsonschema:"minimum=0"`
+
+	// This parameter is used to set the maximum number of bytes the client keeps in memory for writers, buffered batches and reads.
+	// The estimated size of each inserted record counts towards the limit until the record was written, or acknowledged with
+	// `do_exchange`, and inserts pause until their record fits. If this is not set, memory usage is not limited.
+	MemoryLimit int64 `json:"memory_limit,omitempty" jsonschema:"minimum=0"`
+
+	// This parameter is used to select how the size of a record is determined before comparing it to `max_call_send_msg_size`.
+	// `estimate` computes an upper bound from the Arrow buffer lengths, `exact` serializes the record to measure it.
+	RecordSizeMode string `json:"record_size_mode,omitempty" jsonschema:"enum=estimate,enum=exact,default=estimate"`
+
+	// This parameter is used to enable transactional syncs.
+	// Every sync is wrapped in `BeginSync` and `CommitSync` actions, or `RollbackSync` if the sync fails,
+	// so the ArrowFlight service can publish each sync atomically.
+	Transactional bool `json:"transactional,omitempty"`
+
+	// This parameter is used to tell the ArrowFlight service how to apply the written records.
+	// It should match the `write_mode` of the destination.
+	// If this is not set, tables with primary keys are written in `overwrite` mode and tables without in `append` mode.
+	WriteMode string `json:"write_mode,omitempty" jsonschema:"enum=append,enum=overwrite,enum=overwrite-delete-stale"`
+
+	// This parameter is used to allow unsafe schema changes, e.g. changing a column type or the primary key.
+	// In `safe` mode migrations requiring unsafe changes are rejected unless the destination `migrate_mode` is `forced`.
+	MigrateMode string `json:"migrate_mode,omitempty" jsonschema:"enum=safe,enum=forced,default=safe"`
+
+	// This parameter is used to limit how long the calls to the ArrowFlight service may take.
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+
+	// This parameter is used to send gRPC keepalive pings, so connections dropped while idle are detected before the next call.
+	Keepalive Keepalive `json:"keepalive,omitempty"`
+
+	// This parameter is used to close the connection after it had no active calls for this long, e.g. `5m`.
+	// The connection is reestablished by the next call. gRPC defaults to `30m`.
+	IdleTimeout configtype.Duration `json:"idle_timeout,omitempty"`
+
+	// This parameter is used to configure the delay between attempts to connect to an address of the ArrowFlight service.
+	Backoff Backoff `json:"backoff,omitempty"`
+
+	// This parameter is used to buffer the `DeleteRecord` messages of each table and send up to this many of them in a single
+	// `DeleteRecordBatch` action. Buffered messages are sent before any other message of the table, so they keep their order
+	// relative to the inserts. `1` sends every message in its own `DeleteRecord` action.
+	DeleteRecordBatchSize int `json:"delete_record_batch_size,omitempty" jsonschema:"minimum=1,default=1"`
+
+	// This parameter is used to send the buffered `DeleteRecord` messages at least this often, e.g. `5s`.
+	// If this is not set, they are only sent once `delete_record_batch_size` is reached, before another message of the table
+	// and at the end of the sync.
+	DeleteRecordBatchInterval configtype.Duration `json:"delete_record_batch_interval,omitempty"`
+
+	// This parameter is used to report what would be sent to the ArrowFlight service instead of sending it.
+	// `MigrateTable`, `DeleteStale` and `DeleteRecord` are logged and inserts are counted per table.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// This parameter is used to write the inserted records of a dry run to `<table name>.arrow` Arrow IPC files in the given directory.
+	// With `targets` the files of each target are written to a subdirectory named after the target.
+	DryRunOutputDir string `json:"dry_run_output_dir,omitempty"`
+
+	// This parameter is used to set the path of the flight descriptors, which is followed by the table name.
+	DescriptorPath []string `json:"descriptor_path,omitempty" jsonschema:"default=cloudquery,default=arrowflight"`
+
+	// This parameter is used to write every message to several ArrowFlight services concurrently instead of `addr`.
+	// The other parameters apply to every target.
+	Targets []Target `json:"targets,omitempty"`
+
+	// This parameter is used to send tables to a single target instead of every target.
+	// Each table is sent to the target of the first route matching it. Tables not matched by any route are sent to every target.
+	Routes []Route `json:"routes,omitempty"`
+
+	// Glob patterns of the tables written to the ArrowFlight service, e.g. `aws_*`.
+	// If this is not set, every table is written.
+	IncludeTables []string `json:"include_tables,omitempty" jsonschema:"example=aws_*"`
+
+	// Glob patterns of the tables not written to the ArrowFlight service. They take precedence over `include_tables`.
+	ExcludeTables []string `json:"exclude_tables,omitempty" jsonschema:"example=aws_iam_*"`
+
+	// Glob patterns of the columns written to the ArrowFlight service, in the form `<table>.<column>`, e.g. `aws_ec2_*.instance_*`.
+	// Only the matching columns of the tables matched by a pattern are written, the columns of the other tables aren't filtered.
+	IncludeColumns []string `json:"include_columns,omitempty" jsonschema:"example=aws_ec2_*.instance_*"`
+
+	// Glob patterns of the columns not written to the ArrowFlight service, in the form `<table>.<column>`, e.g. `*.policy_document`.
+	// They take precedence over `include_columns`. Primary key and CloudQuery (`_cq_*`) columns are always written.
+	ExcludeColumns []string `json:"exclude_columns,omitempty" jsonschema:"example=*.policy_document"`
+
+	// This parameter is used to mask the values of columns before they are written to the ArrowFlight service.
+	// Each column is masked by the first transform matching it. CloudQuery (`_cq_*`) columns are never masked.
+	Transforms []Transform `json:"transforms,omitempty"`
+
+	// This parameter is used to rewrite the CloudQuery extension types (UUID, JSON, inet and MAC) and the large types
+	// to types every ArrowFlight service understands.
+	TypeCompatibility TypeCompatibility `json:"type_compatibility,omitempty"`
+
+	// This parameter is used to rewrite timestamps and decimals to the units and precisions the ArrowFlight service stores.
+	Normalization Normalization `json:"normalization,omitempty"`
+
+	// This parameter is used to write nested columns to ArrowFlight services which only support flat schemas.
+	// `keep` writes them as they are, `flatten` writes the fields of struct columns as `<column>__<field>` columns
+	// and serializes lists and maps as JSON strings, `json` serializes structs, lists and maps as JSON strings.
+	NestedColumns string `json:"nested_columns,omitempty" jsonschema:"enum=keep,enum=flatten,enum=json,default=keep"`
+
+	// This parameter is used to rename the tables and columns to the names the ArrowFlight service stores.
+	// The renamed names are used in the flight descriptors, the migrated schemas, the written records and the delete messages,
+	// and read records are renamed back.
+	Naming Naming `json:"naming,omitempty"`
 }
 
 func (s *Spec) SetDefaults() {
@@ -42,12 +221,165 @@ func (s *Spec) SetDefaults() {
 	if s.MaxCallSendMsgSize <= 0 {
 		s.MaxCallSendMsgSize = defaultMaxCallSendMsgSize
 	}
+	if len(s.DescriptorPath) == 0 {
+		s.DescriptorPath = defaultDescriptorPath
+	}
+	for i := range s.Targets {
+		s.Targets[i].SetDefaults()
+	}
+	for i := range s.Transforms {
+		s.Transforms[i].SetDefaults()
+	}
+	s.TypeCompatibility.SetDefaults()
+	s.Normalization.SetDefaults()
+	s.Timeouts.SetDefaults()
+	if len(s.NestedColumns) == 0 {
+		s.NestedColumns = NestedColumnsKeep
+	}
+	s.Naming.SetDefaults()
+	if len(s.LoadBalancingPolicy) == 0 {
+		s.LoadBalancingPolicy = LoadBalancingPolicyPickFirst
+	}
+	if len(s.WriteTransport) == 0 {
+		s.WriteTransport = WriteTransportDoPut
+	}
+	if s.ExchangeWindowSize <= 0 {
+		s.ExchangeWindowSize = defaultExchangeWindowSize
+	}
+	if len(s.MigrateMode) == 0 {
+		s.MigrateMode = MigrateModeSafe
+	}
+	if s.DeleteRecordBatchSize <= 0 {
+		s.DeleteRecordBatchSize = defaultDeleteRecordBatchSize
+	}
+	if len(s.RecordSizeMode) == 0 {
+		s.RecordSizeMode = RecordSizeModeEstimate
+	}
 }
 
 func (s *Spec) Validate() error {
+	if len(s.Targets) > 0 {
+		if len(s.Addr) > 0 {
+			return errors.New("`addr` and `targets` are mutually exclusive")
+		}
+		names := make(map[string]bool, len(s.Targets))
+		for i, target := range s.Targets {
+			if err := target.Validate(); err != nil {
+				return fmt.Errorf("invalid target %d: %w", i, err)
+			}
+			if names[target.Name] {
+				return fmt.Errorf("duplicate target name %q", target.Name)
+			}
+			names[target.Name] = true
+			if len(s.DryRunOutputDir) > 0 && (strings.ContainsAny(target.Name, `/\`) || target.Name == "." || target.Name == "..") {
+				return fmt.Errorf("target name %q can't be used as a directory of `dry_run_output_dir`", target.Name)
+			}
+			targetSpec := s.ForTarget(target)
+			if err := targetSpec.Validate(); err != nil {
+				return fmt.Errorf("invalid target %q: %w", target.Name, err)
+			}
+		}
+		for i, route := range s.Routes {
+			if err := route.Validate(s.Targets); err != nil {
+				return fmt.Errorf("invalid route %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	if len(s.Routes) > 0 {
+		return errors.New("`routes` requires `targets`")
+	}
 	if len(s.Addr) == 0 {
 		return errors.New("`addr` is required")
 	}
+	for _, addr := range s.Addrs() {
+		if len(addr) == 0 {
+			return errors.New("`addr` must not contain empty addresses")
+		}
+	}
+	switch s.LoadBalancingPolicy {
+	case "", LoadBalancingPolicyPickFirst, LoadBalancingPolicyRoundRobin:
+	default:
+		return fmt.Errorf("`load_balancing_policy` must be one of %q or %q", LoadBalancingPolicyPickFirst, LoadBalancingPolicyRoundRobin)
+	}
+	switch s.WriteTransport {
+	case "", WriteTransportDoPut, WriteTransportDoExchange:
+	default:
+		return fmt.Errorf("`write_transport` must be one of %q or %q", WriteTransportDoPut, WriteTransportDoExchange)
+	}
+	switch s.WriteMode {
+	case "", WriteModeAppend, WriteModeOverwrite, WriteModeOverwriteDeleteStale:
+	default:
+		return fmt.Errorf("`write_mode` must be one of %q, %q or %q", WriteModeAppend, WriteModeOverwrite, WriteModeOverwriteDeleteStale)
+	}
+	switch s.MigrateMode {
+	case "", MigrateModeSafe, MigrateModeForced:
+	default:
+		return fmt.Errorf("`migrate_mode` must be one of %q or %q", MigrateModeSafe, MigrateModeForced)
+	}
+	switch s.RecordSizeMode {
+	case "", RecordSizeModeEstimate, RecordSizeModeExact:
+	default:
+		return fmt.Errorf("`record_size_mode` must be one of %q or %q", RecordSizeModeEstimate, RecordSizeModeExact)
+	}
+	if s.DeleteRecordBatchInterval.Duration() < 0 {
+		return errors.New("`delete_record_batch_interval` must not be negative")
+	}
+	if s.DeleteRecordBatchInterval.Duration() > 0 && s.DeleteRecordBatchSize <= 1 {
+		return errors.New("`delete_record_batch_interval` requires `delete_record_batch_size` greater than 1")
+	}
+	if err := validateTablePatterns("include_tables", s.IncludeTables); err != nil {
+		return err
+	}
+	if err := validateTablePatterns("exclude_tables", s.ExcludeTables); err != nil {
+		return err
+	}
+	if err := validateColumnPatterns("include_columns", s.IncludeColumns); err != nil {
+		return err
+	}
+	if err := validateColumnPatterns("exclude_columns", s.ExcludeColumns); err != nil {
+		return err
+	}
+	for i, transform := range s.Transforms {
+		if err := transform.Validate(); err != nil {
+			return fmt.Errorf("invalid transform %d: %w", i, err)
+		}
+	}
+	if err := s.TypeCompatibility.Validate(); err != nil {
+		return err
+	}
+	if err := s.Normalization.Validate(); err != nil {
+		return err
+	}
+	if err := s.Keepalive.Validate(); err != nil {
+		return err
+	}
+	if s.IdleTimeout.Duration() < 0 {
+		return errors.New("`idle_timeout` must not be negative")
+	}
+	if err := s.Backoff.Validate(); err != nil {
+		return err
+	}
+	if err := s.Timeouts.Validate(); err != nil {
+		return err
+	}
+	switch s.NestedColumns {
+	case "", NestedColumnsKeep, NestedColumnsFlatten, NestedColumnsJSON:
+	default:
+		return fmt.Errorf("`nested_columns` must be one of %q, %q or %q", NestedColumnsKeep, NestedColumnsFlatten, NestedColumnsJSON)
+	}
+	if err := s.Naming.Validate(); err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// Addrs returns the addresses listed in `addr`.
+func (s *Spec) Addrs() []string {
+	addrs := strings.Split(s.Addr, ",")
+	for i, addr := range addrs {
+		addrs[i] = strings.TrimSpace(addr)
+	}
+	return addrs
+}
@@ -32,5 +32,162 @@ func TestSpec_JSONSchemaExtend(t *testing.T) {
 			Name: "non-empty addr",
 			Spec: `{"addr": "abc"}`,
 		},
+		{
+			Name: "do_exchange write_transport",
+			Spec: `{"addr": "abc", "write_transport": "do_exchange"}`,
+		},
+		{
+			Name: "targets",
+			Spec: `{"targets": [{"name": "primary", "addr": "abc"}, {"name": "archive", "addr": "def", "error_policy": "best_effort"}]}`,
+		},
+		{
+			Name: "targets with addr",
+			Spec: `{"addr": "abc", "targets": [{"name": "primary", "addr": "abc"}]}`,
+			Err:  true,
+		},
+		{
+			Name: "target without addr",
+			Spec: `{"targets": [{"name": "primary"}]}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid target error_policy",
+			Spec: `{"targets": [{"name": "primary", "addr": "abc", "error_policy": "ignore"}]}`,
+			Err:  true,
+		},
+		{
+			Name: "routes",
+			Spec: `{"targets": [{"name": "aws", "addr": "abc"}, {"name": "gcp", "addr": "def"}], "routes": [{"tables": ["aws_*"], "target": "aws"}, {"source_name": "gcp*", "target": "gcp"}]}`,
+		},
+		{
+			Name: "route without target",
+			Spec: `{"targets": [{"name": "aws", "addr": "abc"}], "routes": [{"tables": ["aws_*"]}]}`,
+			Err:  true,
+		},
+		{
+			Name: "route with empty target",
+			Spec: `{"targets": [{"name": "aws", "addr": "abc"}], "routes": [{"tables": ["aws_*"], "target": ""}]}`,
+			Err:  true,
+		},
+		{
+			Name: "table and column filters",
+			Spec: `{"addr": "abc", "include_tables": ["aws_*"], "exclude_tables": ["aws_iam_*"], "include_columns": ["aws_ec2_*.instance_*"], "exclude_columns": ["*.policy_document"]}`,
+		},
+		{
+			Name: "integer exclude_tables",
+			Spec: `{"addr": "abc", "exclude_tables": [123]}`,
+			Err:  true,
+		},
+		{
+			Name: "transforms",
+			Spec: `{"addr": "abc", "transforms": [{"columns": ["aws_iam_users.email"], "type": "sha256", "salt": "salt"}, {"columns": ["*.tags"], "type": "redact", "pattern": "secret"}]}`,
+		},
+		{
+			Name: "transform without columns",
+			Spec: `{"addr": "abc", "transforms": [{"type": "null"}]}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid transform type",
+			Spec: `{"addr": "abc", "transforms": [{"columns": ["aws_iam_users.email"], "type": "md5"}]}`,
+			Err:  true,
+		},
+		{
+			Name: "type_compatibility",
+			Spec: `{"addr": "abc", "type_compatibility": {"enabled": true, "uuid": "fixed_size_binary", "json": "binary"}}`,
+		},
+		{
+			Name: "invalid type_compatibility uuid",
+			Spec: `{"addr": "abc", "type_compatibility": {"enabled": true, "uuid": "binary"}}`,
+			Err:  true,
+		},
+		{
+			Name: "normalization",
+			Spec: `{"addr": "abc", "normalization": {"timestamp_unit": "us", "timestamp_timezone": "UTC", "decimal_max_precision": 38, "precision_loss": "truncate"}}`,
+		},
+		{
+			Name: "invalid normalization timestamp_unit",
+			Spec: `{"addr": "abc", "normalization": {"timestamp_unit": "m"}}`,
+			Err:  true,
+		},
+		{
+			Name: "too large normalization decimal_max_precision",
+			Spec: `{"addr": "abc", "normalization": {"decimal_max_precision": 77}}`,
+			Err:  true,
+		},
+		{
+			Name: "flatten nested_columns",
+			Spec: `{"addr": "abc", "nested_columns": "flatten"}`,
+		},
+		{
+			Name: "invalid nested_columns",
+			Spec: `{"addr": "abc", "nested_columns": "drop"}`,
+			Err:  true,
+		},
+		{
+			Name: "naming",
+			Spec: `{"addr": "abc", "naming": {"tables": {"aws_s3_buckets": "Buckets"}, "table_convention": "upper", "columns": {"_cq_id": "cqId"}, "column_convention": "camel", "strip_prefixes": ["_cq_"]}}`,
+		},
+		{
+			Name: "invalid naming column_convention",
+			Spec: `{"addr": "abc", "naming": {"column_convention": "kebab"}}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid naming tables",
+			Spec: `{"addr": "abc", "naming": {"tables": {"aws_s3_buckets": 1}}}`,
+			Err:  true,
+		},
+		{
+			Name: "delete_record_batch_size and delete_record_batch_interval",
+			Spec: `{"addr": "abc", "delete_record_batch_size": 100, "delete_record_batch_interval": "5s"}`,
+		},
+		{
+			Name: "zero delete_record_batch_size",
+			Spec: `{"addr": "abc", "delete_record_batch_size": 0}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid delete_record_batch_interval",
+			Spec: `{"addr": "abc", "delete_record_batch_interval": 5}`,
+			Err:  true,
+		},
+		{
+			Name: "timeouts",
+			Spec: `{"addr": "abc", "timeouts": {"action": "30s", "actions": {"DeleteStale": "10m"}, "close_drain": "5s"}}`,
+		},
+		{
+			Name: "invalid timeouts do_get",
+			Spec: `{"addr": "abc", "timeouts": {"do_get": 5}}`,
+			Err:  true,
+		},
+		{
+			Name: "keepalive, idle_timeout and backoff",
+			Spec: `{"addr": "abc", "keepalive": {"time": "60s", "timeout": "20s", "permit_without_stream": true}, "idle_timeout": "5m", "backoff": {"base_delay": "500ms", "multiplier": 2, "jitter": 0.1, "max_delay": "30s"}}`,
+		},
+		{
+			Name: "invalid backoff multiplier",
+			Spec: `{"addr": "abc", "backoff": {"multiplier": 0.5}}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid backoff jitter",
+			Spec: `{"addr": "abc", "backoff": {"jitter": 2}}`,
+			Err:  true,
+		},
+		{
+			Name: "round_robin load_balancing_policy",
+			Spec: `{"addr": "abc,def", "load_balancing_policy": "round_robin"}`,
+		},
+		{
+			Name: "invalid load_balancing_policy",
+			Spec: `{"addr": "abc", "load_balancing_policy": "random"}`,
+			Err:  true,
+		},
+		{
+			Name: "invalid write_transport",
+			Spec: `{"addr": "abc", "write_transport": "do_get"}`,
+			Err:  true,
+		},
 	})
 }
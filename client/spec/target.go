@@ -0,0 +1,95 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	ErrorPolicyRequired   = "required"
+	ErrorPolicyBestEffort = "best_effort"
+)
+
+// Target is a named ArrowFlight service receiving a copy of every message.
+type Target struct {
+	// The name of the target, used in logs and errors.
+	Name string `json:"name" jsonschema:"required,minLength=1,example=primary"`
+
+	// The address of the ArrowFlight service of the target. See `addr`.
+	Addr string `json:"addr" jsonschema:"required,minLength=1,example=localhost:9090"`
+
+	// This parameter is used to select how calls are spread over the addresses of the target. See `load_balancing_policy`.
+	LoadBalancingPolicy string `json:"load_balancing_policy,omitempty" jsonschema:"enum=pick_first,enum=round_robin,default=pick_first"`
+
+	// This parameter is used to enable gRPC health checks of the addresses of the target. See `health_check`.
+	HealthCheck bool `json:"health_check,omitempty"`
+
+	// This parameter is used to authenticate with the target during the handshake.
+	Handshake string `json:"handshake,omitempty"`
+
+	// This parameter is used to subsequently authenticate with the target in future calls.
+	Token string `json:"token,omitempty"`
+
+	// This parameter is used to Enable TLS.
+	TlsEnabled bool `json:"tls_enabled,omitempty"`
+
+	// This parameter is used to set the server name used to verify the hostname on the returned certificates.
+	TlsServerName string `json:"tls_server_name,omitempty"`
+
+	// This parameter is used to skip the verification of the server's certificate chain and host name.
+	TlsInsecureSkipVerify bool `json:"tls_insecure_skip_verify,omitempty"`
+
+	// This parameter is used to override the path of the flight descriptors sent to the target. See `descriptor_path`.
+	DescriptorPath []string `json:"descriptor_path,omitempty"`
+
+	// This parameter is used to select what happens when writing to the target fails.
+	// A `required` target fails the sync, a `best_effort` target only logs the failure and stops receiving messages.
+	ErrorPolicy string `json:"error_policy,omitempty" jsonschema:"enum=required,enum=best_effort,default=required"`
+}
+
+func (t *Target) SetDefaults() {
+	if len(t.ErrorPolicy) == 0 {
+		t.ErrorPolicy = ErrorPolicyRequired
+	}
+}
+
+func (t *Target) Validate() error {
+	if len(t.Name) == 0 {
+		return errors.New("`name` is required")
+	}
+	if len(t.Addr) == 0 {
+		return errors.New("`addr` is required")
+	}
+	switch t.ErrorPolicy {
+	case "", ErrorPolicyRequired, ErrorPolicyBestEffort:
+	default:
+		return fmt.Errorf("`error_policy` must be one of %q or %q", ErrorPolicyRequired, ErrorPolicyBestEffort)
+	}
+	return nil
+}
+
+// ForTarget returns the spec used to connect to the target: the connection settings of the target
+// combined with the other settings of the spec. The dry run files of the target are written to a directory named after it.
+func (s Spec) ForTarget(t Target) Spec {
+	s.Targets = nil
+	s.Routes = nil
+	s.Addr = t.Addr
+	s.HealthCheck = t.HealthCheck
+	s.Handshake = t.Handshake
+	s.Token = t.Token
+	s.TlsEnabled = t.TlsEnabled
+	s.TlsServerName = t.TlsServerName
+	s.TlsInsecureSkipVerify = t.TlsInsecureSkipVerify
+	if len(t.LoadBalancingPolicy) > 0 {
+		s.LoadBalancingPolicy = t.LoadBalancingPolicy
+	}
+	if len(t.DescriptorPath) > 0 {
+		s.DescriptorPath = t.DescriptorPath
+	}
+	if len(s.DryRunOutputDir) > 0 {
+		// Every target writes its own dry run files, so they are kept apart by the target name.
+		s.DryRunOutputDir = filepath.Join(s.DryRunOutputDir, t.Name)
+	}
+	return s
+}
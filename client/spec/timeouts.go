@@ -0,0 +1,75 @@
+package spec
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/v4/configtype"
+)
+
+const defaultCloseDrainTimeout = 10 * time.Second
+
+// Timeouts limit how long the calls to the ArrowFlight service may take, e.g. `30s`. Calls without a timeout aren't limited.
+type Timeouts struct {
+	// The timeout of each attempt to connect to an address of the ArrowFlight service.
+	Connect configtype.Duration `json:"connect,omitempty"`
+
+	// The timeout of the handshake.
+	Handshake configtype.Duration `json:"handshake,omitempty"`
+
+	// The timeout of each action, including reading all its results, and of the `ListActions` call made by the connection test.
+	// The `GetSchema` call made before `MigrateTable` has the timeout of `MigrateTable`.
+	Action configtype.Duration `json:"action,omitempty"`
+
+	// Timeouts of the actions of the given types, e.g. `DeleteStale`, overriding `action`.
+	Actions map[string]configtype.Duration `json:"actions,omitempty"`
+
+	// The timeout of the `GetFlightInfo` call made when reading a table.
+	GetFlightInfo configtype.Duration `json:"get_flight_info,omitempty"`
+
+	// The timeout of reading each endpoint of a table with `DoGet`.
+	DoGet configtype.Duration `json:"do_get,omitempty"`
+
+	// The timeout of writing each batch to the `DoPut` or `DoExchange` stream. The stream is cancelled once it is exceeded,
+	// and the batch is retried on a new stream.
+	Write configtype.Duration `json:"write,omitempty"`
+
+	// How long closing a writer waits for the ArrowFlight service to finish the stream and acknowledge the written batches.
+	CloseDrain configtype.Duration `json:"close_drain,omitempty" jsonschema:"default=10s"`
+}
+
+func (t *Timeouts) SetDefaults() {
+	if t.CloseDrain.Duration() == 0 {
+		t.CloseDrain = configtype.NewDuration(defaultCloseDrainTimeout)
+	}
+}
+
+func (t *Timeouts) Validate() error {
+	for key, timeout := range map[string]configtype.Duration{
+		"connect":         t.Connect,
+		"handshake":       t.Handshake,
+		"action":          t.Action,
+		"get_flight_info": t.GetFlightInfo,
+		"do_get":          t.DoGet,
+		"write":           t.Write,
+		"close_drain":     t.CloseDrain,
+	} {
+		if timeout.Duration() < 0 {
+			return fmt.Errorf("`timeouts.%s` must not be negative", key)
+		}
+	}
+	for actionType, timeout := range t.Actions {
+		if timeout.Duration() < 0 {
+			return fmt.Errorf("`timeouts.actions.%s` must not be negative", actionType)
+		}
+	}
+	return nil
+}
+
+// ActionTimeout returns the timeout of the actions of the type.
+func (t *Timeouts) ActionTimeout(actionType string) time.Duration {
+	if timeout, ok := t.Actions[actionType]; ok {
+		return timeout.Duration()
+	}
+	return t.Action.Duration()
+}
@@ -0,0 +1,90 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+const (
+	TransformSHA256   = "sha256"
+	TransformHMAC     = "hmac"
+	TransformNull     = "null"
+	TransformTruncate = "truncate"
+	TransformRedact   = "redact"
+)
+
+const defaultRedactReplacement = "[REDACTED]"
+
+// Transform masks the values of the columns it matches before they are written to the ArrowFlight service.
+type Transform struct {
+	// Glob patterns of the masked columns, in the form `<table>.<column>`, e.g. `aws_iam_users.email`.
+	Columns []string `json:"columns" jsonschema:"required,minItems=1,example=aws_iam_users.email"`
+
+	// The type of the transform.
+	// `sha256` replaces the values with their salted SHA-256 hash and `hmac` with their HMAC-SHA256, both stored as 32 bytes fixed-size binary.
+	// `null` replaces the values with nulls, `truncate` keeps the first `length` characters and `redact` replaces the matches of `pattern` with `replacement`.
+	// Primary key columns can only be masked by `sha256` and `hmac`.
+	Type string `json:"type" jsonschema:"required,enum=sha256,enum=hmac,enum=null,enum=truncate,enum=redact"`
+
+	// The salt prepended to the values hashed by the `sha256` transform.
+	Salt string `json:"salt,omitempty"`
+
+	// The key of the `hmac` transform.
+	Key string `json:"key,omitempty"`
+
+	// The number of characters kept by the `truncate` transform.
+	Length int `json:"length,omitempty" jsonschema:"minimum=1"`
+
+	// The regular expression redacted by the `redact` transform.
+	Pattern string `json:"pattern,omitempty"`
+
+	// The replacement of the matches of the `redact` transform. It may reference capture groups, e.g. `$1`.
+	Replacement string `json:"replacement,omitempty" jsonschema:"default=[REDACTED]"`
+}
+
+func (t *Transform) SetDefaults() {
+	if t.Type == TransformRedact && len(t.Replacement) == 0 {
+		t.Replacement = defaultRedactReplacement
+	}
+}
+
+func (t *Transform) Validate() error {
+	if len(t.Columns) == 0 {
+		return errors.New("`columns` is required")
+	}
+	if err := validateColumnPatterns("columns", t.Columns); err != nil {
+		return err
+	}
+	switch t.Type {
+	case TransformSHA256, TransformNull:
+	case TransformHMAC:
+		if len(t.Key) == 0 {
+			return errors.New("`key` is required for the `hmac` transform")
+		}
+	case TransformTruncate:
+		if t.Length <= 0 {
+			return errors.New("`length` must be positive for the `truncate` transform")
+		}
+	case TransformRedact:
+		if len(t.Pattern) == 0 {
+			return errors.New("`pattern` is required for the `redact` transform")
+		}
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			return fmt.Errorf("invalid `pattern`: %w", err)
+		}
+	default:
+		return fmt.Errorf("`type` must be one of %q", []string{TransformSHA256, TransformHMAC, TransformNull, TransformTruncate, TransformRedact})
+	}
+	return nil
+}
+
+// ColumnTransform returns the index of the first transform matching the column of the table, or -1 if none matches.
+func (s *Spec) ColumnTransform(tableName, columnName string) int {
+	return slices.IndexFunc(s.Transforms, func(t Transform) bool {
+		return slices.ContainsFunc(t.Columns, func(pattern string) bool {
+			return matchColumn(pattern, tableName, columnName)
+		})
+	})
+}
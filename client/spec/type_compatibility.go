@@ -0,0 +1,71 @@
+package spec
+
+import (
+	"fmt"
+)
+
+const (
+	CompatibleTypeString          = "string"
+	CompatibleTypeBinary          = "binary"
+	CompatibleTypeFixedSizeBinary = "fixed_size_binary"
+)
+
+// TypeCompatibility rewrites the CloudQuery extension types and the large types to types every ArrowFlight service understands.
+type TypeCompatibility struct {
+	// This parameter is used to rewrite the types of the migrated tables, the written records and the delete predicates,
+	// and to rewrite them back when reading.
+	// `large_string` and `large_binary` are written as `string` and `binary`, the extension types according to their parameters.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// The type UUID columns are written as. `string` writes the canonical text form, `fixed_size_binary` the 16 bytes.
+	UUID string `json:"uuid,omitempty" jsonschema:"enum=string,enum=fixed_size_binary,default=string"`
+
+	// The type JSON columns are written as. `string` writes the JSON text, `binary` the JSON bytes.
+	JSON string `json:"json,omitempty" jsonschema:"enum=string,enum=binary,default=string"`
+
+	// The type inet columns are written as. `string` writes the CIDR notation, `binary` the storage of the extension type.
+	Inet string `json:"inet,omitempty" jsonschema:"enum=string,enum=binary,default=string"`
+
+	// The type MAC address columns are written as. `string` writes the colon-separated notation, `binary` the address bytes.
+	MAC string `json:"mac,omitempty" jsonschema:"enum=string,enum=binary,default=string"`
+}
+
+func (t *TypeCompatibility) SetDefaults() {
+	for _, compatibleType := range []*string{&t.UUID, &t.JSON, &t.Inet, &t.MAC} {
+		if len(*compatibleType) == 0 {
+			*compatibleType = CompatibleTypeString
+		}
+	}
+}
+
+func (t *TypeCompatibility) Validate() error {
+	if err := validateCompatibleType("uuid", t.UUID, CompatibleTypeFixedSizeBinary); err != nil {
+		return err
+	}
+	if err := validateCompatibleType("json", t.JSON, CompatibleTypeBinary); err != nil {
+		return err
+	}
+	if err := validateCompatibleType("inet", t.Inet, CompatibleTypeBinary); err != nil {
+		return err
+	}
+	return validateCompatibleType("mac", t.MAC, CompatibleTypeBinary)
+}
+
+// ExtensionTypes returns the types the extension types are written as, by extension name.
+func (t *TypeCompatibility) ExtensionTypes() map[string]string {
+	return map[string]string{
+		"uuid": t.UUID,
+		"json": t.JSON,
+		"inet": t.Inet,
+		"mac":  t.MAC,
+	}
+}
+
+func validateCompatibleType(name, compatibleType, storageType string) error {
+	switch compatibleType {
+	case "", CompatibleTypeString, storageType:
+		return nil
+	default:
+		return fmt.Errorf("`type_compatibility.%s` must be one of %q or %q", name, CompatibleTypeString, storageType)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	resources "github.com/spangenberg/cq-destination-arrowflight/resources/plugin"
+)
+
+const (
+	// cqSyncGroupIDColumn is added by the CLI to every table when `sync_group_id` is set.
+	cqSyncGroupIDColumn = "_cq_sync_group_id"
+)
+
+// syncContext describes the sync the records of a DoPut stream belong to.
+type syncContext struct {
+	SourceName    string     `json:"source_name,omitempty"`
+	SyncTime      *time.Time `json:"sync_time,omitempty"`
+	SyncGroupID   string     `json:"sync_group_id,omitempty"`
+	WriteMode     string     `json:"write_mode,omitempty"`
+	PluginVersion string     `json:"plugin_version,omitempty"`
+}
+
+// newSyncContext reads the sync context from the CloudQuery columns of the first row of the record.
+func newSyncContext(rec arrow.Record, writeMode string) *syncContext {
+	sc := &syncContext{
+		SourceName:    stringValue(rec, schema.CqSourceNameColumn.Name),
+		SyncGroupID:   stringValue(rec, cqSyncGroupIDColumn),
+		WriteMode:     writeMode,
+		PluginVersion: resources.Version,
+	}
+	if syncTime, ok := timestampValue(rec, schema.CqSyncTimeColumn.Name); ok {
+		sc.SyncTime = &syncTime
+	}
+	return sc
+}
+
+func stringValue(rec arrow.Record, name string) string {
+	column := firstValue(rec, name)
+	if column == nil {
+		return ""
+	}
+	switch column := column.(type) {
+	case *array.String:
+		return column.Value(0)
+	case *array.LargeString:
+		return column.Value(0)
+	default:
+		return ""
+	}
+}
+
+func timestampValue(rec arrow.Record, name string) (time.Time, bool) {
+	column, ok := firstValue(rec, name).(*array.Timestamp)
+	if !ok {
+		return time.Time{}, false
+	}
+	unit := column.DataType().(*arrow.TimestampType).Unit
+	return column.Value(0).ToTime(unit).UTC(), true
+}
+
+// firstValue returns the column with the given name if its first row is set.
+func firstValue(rec arrow.Record, name string) arrow.Array {
+	if rec.NumRows() == 0 {
+		return nil
+	}
+	indices := rec.Schema().FieldIndices(name)
+	if len(indices) == 0 {
+		return nil
+	}
+	column := rec.Column(indices[0])
+	if column.IsNull(0) {
+		return nil
+	}
+	return column
+}
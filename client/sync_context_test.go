@@ -0,0 +1,58 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func TestNewSyncContext(t *testing.T) {
+	syncTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		table         *schema.Table
+		wantWriteMode string
+	}{
+		{
+			name: "should read an append table",
+			table: &schema.Table{
+				Name:    "test_append",
+				Columns: schema.ColumnList{schema.CqSourceNameColumn, schema.CqSyncTimeColumn, {Name: cqSyncGroupIDColumn, Type: arrow.BinaryTypes.String}},
+			},
+			wantWriteMode: spec.WriteModeAppend,
+		},
+		{
+			name: "should read an overwrite table",
+			table: &schema.Table{
+				Name:    "test_overwrite",
+				Columns: schema.ColumnList{schema.CqSourceNameColumn, schema.CqSyncTimeColumn, {Name: cqSyncGroupIDColumn, Type: arrow.BinaryTypes.String}, {Name: "id", Type: arrow.BinaryTypes.String, PrimaryKey: true}},
+			},
+			wantWriteMode: spec.WriteModeOverwrite,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := schema.NewTestDataGenerator(0).Generate(tt.table, schema.GenTestDataOptions{
+				SourceName: "test_source",
+				SyncTime:   syncTime,
+				MaxRows:    1,
+			})
+			defer rec.Release()
+
+			sc := newSyncContext(rec, (&Client{}).writeMode(tt.table))
+			assert.Equal(t, "test_source", sc.SourceName)
+			require.NotNil(t, sc.SyncTime)
+			assert.True(t, syncTime.Equal(*sc.SyncTime))
+			assert.NotEmpty(t, sc.SyncGroupID)
+			assert.Equal(t, tt.wantWriteMode, sc.WriteMode)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+const (
+	// tableDefinitionVersion is bumped whenever the table definition changes in a way servers must know about.
+	tableDefinitionVersion = 1
+
+	// metadataTableDefinition is added to the schema metadata sent with MigrateTable.
+	metadataTableDefinition = "cq:table_definition"
+)
+
+// tableDefinition describes a table explicitly, so servers don't have to read the CloudQuery Arrow metadata keys.
+type tableDefinition struct {
+	Version              int                `json:"version"`
+	Name                 string             `json:"name"`
+	ParentTable          string             `json:"parent_table,omitempty"`
+	WriteMode            string             `json:"write_mode"`
+	IsIncremental        bool               `json:"is_incremental"`
+	PrimaryKeys          []string           `json:"primary_keys"`
+	PrimaryKeyComponents []string           `json:"primary_key_components,omitempty"`
+	IncrementalKeys      []string           `json:"incremental_keys,omitempty"`
+	CqIDUnique           bool               `json:"cq_id_unique"`
+	Columns              []columnDefinition `json:"columns"`
+}
+
+type columnDefinition struct {
+	Name                string `json:"name"`
+	Type                string `json:"type"`
+	NotNull             bool   `json:"not_null,omitempty"`
+	Unique              bool   `json:"unique,omitempty"`
+	PrimaryKey          bool   `json:"primary_key,omitempty"`
+	PrimaryKeyComponent bool   `json:"primary_key_component,omitempty"`
+	IncrementalKey      bool   `json:"incremental_key,omitempty"`
+}
+
+func newTableDefinition(table *schema.Table, writeMode string) *tableDefinition {
+	definition := &tableDefinition{
+		Version:              tableDefinitionVersion,
+		Name:                 table.Name,
+		WriteMode:            writeMode,
+		IsIncremental:        table.IsIncremental,
+		PrimaryKeys:          table.PrimaryKeys(),
+		PrimaryKeyComponents: table.PrimaryKeyComponents(),
+		IncrementalKeys:      table.IncrementalKeys(),
+		Columns:              make([]columnDefinition, len(table.Columns)),
+	}
+	if definition.PrimaryKeys == nil {
+		definition.PrimaryKeys = []string{}
+	}
+	if table.Parent != nil {
+		definition.ParentTable = table.Parent.Name
+	}
+	for i, column := range table.Columns {
+		definition.Columns[i] = newColumnDefinition(column)
+		if column.Name == schema.CqIDColumn.Name {
+			definition.CqIDUnique = column.Unique || (column.PrimaryKey && len(definition.PrimaryKeys) == 1)
+		}
+	}
+	return definition
+}
+
+func newColumnDefinition(column schema.Column) columnDefinition {
+	return columnDefinition{
+		Name:                column.Name,
+		Type:                column.Type.String(),
+		NotNull:             column.NotNull,
+		Unique:              column.Unique,
+		PrimaryKey:          column.PrimaryKey,
+		PrimaryKeyComponent: column.PrimaryKeyComponent,
+		IncrementalKey:      column.IncrementalKey,
+	}
+}
+
+func (d *tableDefinition) marshal() (string, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal table definition: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableDefinition(t *testing.T) {
+	table := &schema.Table{
+		Name:          "test_child",
+		Parent:        &schema.Table{Name: "test_parent"},
+		IsIncremental: true,
+		Columns: schema.ColumnList{
+			schema.CqIDColumn,
+			{Name: "id", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "updated_at", Type: arrow.FixedWidthTypes.Timestamp_us, IncrementalKey: true},
+		},
+	}
+
+	definition, err := newTableDefinition(table, "overwrite").marshal()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": 1,
+		"name": "test_child",
+		"parent_table": "test_parent",
+		"write_mode": "overwrite",
+		"is_incremental": true,
+		"primary_keys": ["id"],
+		"incremental_keys": ["updated_at"],
+		"cq_id_unique": true,
+		"columns": [
+			{"name": "_cq_id", "type": "uuid", "not_null": true, "unique": true},
+			{"name": "id", "type": "utf8", "not_null": true, "primary_key": true},
+			{"name": "updated_at", "type": "timestamp[us, tz=UTC]", "incremental_key": true}
+		]
+	}`, definition)
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// targetQueueSize is the number of messages buffered per target, so a slow target doesn't hold back the others right away.
+const targetQueueSize = 64
+
+// maxPendingMessages is the number of messages held back per table until its route is resolved without a source name.
+const maxPendingMessages = 1000
+
+// target is a named ArrowFlight service receiving a copy of every message through its own client.
+type target struct {
+	name        string
+	errorPolicy string
+	client      *Client
+}
+
+func (t *target) required() bool {
+	return t.errorPolicy != spec.ErrorPolicyBestEffort
+}
+
+// targetFeed passes the messages of a sync to the client of a target.
+type targetFeed struct {
+	target   *target
+	messages chan message.WriteMessage
+	done     chan struct{}
+	err      error
+}
+
+// initTargets connects a client to every target. The clients share the allocator, so `memory_limit` applies to all targets together.
+// A best-effort target which can't be connected is skipped.
+func (c *Client) initTargets(ctx context.Context) error {
+	for _, t := range c.spec.Targets {
+		child := &Client{
+			allocator: c.allocator,
+			logger:    c.logger.With().Str("target", t.Name).Logger(),
+			spec:      c.spec.ForTarget(t),
+			writers:   make(map[string]*Writer),
+		}
+		if err := child.init(ctx); err != nil {
+			if t.ErrorPolicy == spec.ErrorPolicyBestEffort {
+				child.logger.Warn().Err(err).Msg("failed to connect best effort target, skipping it")
+				continue
+			}
+			_ = c.closeTargets(ctx)
+			return fmt.Errorf("failed to connect target %s: %w", t.Name, err)
+		}
+		c.targets = append(c.targets, &target{
+			name:        t.Name,
+			errorPolicy: t.ErrorPolicy,
+			client:      child,
+		})
+	}
+	if len(c.targets) == 0 {
+		return errors.New("failed to connect any target")
+	}
+	c.router = newRouter(c.spec.Routes, c.targets)
+	return nil
+}
+
+func (c *Client) closeTargets(ctx context.Context) error {
+	var errs []error
+	for _, t := range c.targets {
+		if err := t.client.Close(ctx); err != nil {
+			if !t.required() {
+				t.client.logger.Warn().Err(err).Msg("failed to close best effort target")
+				continue
+			}
+			errs = append(errs, fmt.Errorf("failed to close target %s: %w", t.name, err))
+		}
+	}
+	c.targets = nil
+	return errors.Join(errs...)
+}
+
+// writeTargets passes every message to the clients of the targets it is routed to, which write concurrently. A failing
+// required target stops the sync, a failing best-effort target is logged and doesn't receive any further message.
+// Messages of a table whose route depends on the source name are held back until a message carrying the source name
+// resolves the route. Once maxPendingMessages are held back for a table, its route is resolved without the source name
+// for the rest of the sync.
+// The context isn't cancelled when writeTargets returns, as the writers of the targets keep using it until they are closed.
+func (c *Client) writeTargets(ctx context.Context, res <-chan message.WriteMessage) error {
+	failed := make(chan struct{})
+	var failedOnce sync.Once
+
+	feeds := make([]*targetFeed, len(c.targets))
+	for i, t := range c.targets {
+		feed := &targetFeed{
+			target:   t,
+			messages: make(chan message.WriteMessage, targetQueueSize),
+			done:     make(chan struct{}),
+		}
+		feeds[i] = feed
+		go func() {
+			defer close(feed.done)
+			if feed.err = t.client.Write(ctx, feed.messages); feed.err == nil {
+				return
+			}
+			if t.required() {
+				failedOnce.Do(func() {
+					close(failed)
+				})
+				return
+			}
+			t.client.logger.Warn().Err(feed.err).Msg("best effort target failed, skipping it for the rest of the sync")
+		}()
+	}
+
+	send := func(msg message.WriteMessage, indexes []int) bool {
+		for _, index := range indexes {
+			feed := feeds[index]
+			select {
+			case feed.messages <- msg:
+			case <-feed.done:
+			case <-failed:
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+	everyTarget := make([]int, len(feeds))
+	for i := range feeds {
+		everyTarget[i] = i
+	}
+	// pending holds the messages of the tables whose route isn't resolved yet, in the order of tableNames.
+	pending := make(map[string][]message.WriteMessage)
+	var tableNames []string
+	dropped := make(map[string]bool)
+	// forced holds the targets of the tables resolved without a source name, which the router doesn't keep.
+	forced := make(map[string][]int)
+	route := func(msg message.WriteMessage) bool {
+		if c.router == nil {
+			return send(msg, everyTarget)
+		}
+		tableName, sourceName, ok := routeKey(msg)
+		if !ok {
+			return send(msg, everyTarget)
+		}
+		indexes, resolved := forced[tableName]
+		if !resolved {
+			indexes, resolved = c.router.resolve(tableName, sourceName, false)
+		}
+		if !resolved {
+			if _, ok := pending[tableName]; !ok {
+				tableNames = append(tableNames, tableName)
+			}
+			if len(pending[tableName]) < maxPendingMessages {
+				pending[tableName] = append(pending[tableName], msg)
+				return true
+			}
+			c.logger.Warn().Str("tableName", tableName).Int("messages", maxPendingMessages).Msg("no source name received for table, resolving its route without it")
+			indexes, _ = c.router.resolve(tableName, "", true)
+			forced[tableName] = indexes
+		}
+		if len(indexes) == 0 && !dropped[tableName] {
+			dropped[tableName] = true
+			c.logger.Warn().Str("tableName", tableName).Msg("table is routed to a target which isn't connected, dropping its messages")
+		}
+		if held, ok := pending[tableName]; ok {
+			delete(pending, tableName)
+			for _, msg := range held {
+				if !send(msg, indexes) {
+					return false
+				}
+			}
+		}
+		return send(msg, indexes)
+	}
+
+	stopped := false
+	for msg := range res {
+		if !route(msg) {
+			stopped = true
+			break
+		}
+	}
+	// The routes of the tables which never received a source name are resolved without it.
+	for _, tableName := range tableNames {
+		held, ok := pending[tableName]
+		if !ok || stopped {
+			continue
+		}
+		indexes, _ := c.router.resolve(tableName, "", true)
+		for _, msg := range held {
+			if !send(msg, indexes) {
+				stopped = true
+				break
+			}
+		}
+	}
+
+	var errs []error
+	for _, feed := range feeds {
+		close(feed.messages)
+		<-feed.done
+		if feed.err != nil && feed.target.required() {
+			errs = append(errs, fmt.Errorf("failed to write to target %s: %w", feed.target.name, feed.err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// readTargets reads the table from the first target it is routed to. Reads have no source name, so routes matching
+// the source name are ignored.
+func (c *Client) readTargets(ctx context.Context, table *schema.Table, res chan<- arrow.Record) error {
+	t := c.targets[0]
+	if c.router != nil {
+		indexes, _ := c.router.resolve(table.Name, "", true)
+		if len(indexes) == 0 {
+			return fmt.Errorf("table %s is routed to a target which isn't connected", table.Name)
+		}
+		t = c.targets[indexes[0]]
+	}
+	if err := t.client.Read(ctx, table, res); err != nil {
+		return fmt.Errorf("failed to read from target %s: %w", t.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Targets(t *testing.T) {
+	tests := []struct {
+		name          string
+		errorPolicy   string
+		failAction    string
+		wantErr       string
+		wantSecondary int64
+	}{
+		{
+			name:          "should write to every target",
+			errorPolicy:   "required",
+			wantSecondary: 10,
+		},
+		{
+			name:        "should skip a failing best effort target",
+			errorPolicy: "best_effort",
+			failAction:  migrateTable,
+		},
+		{
+			name:        "should fail on a failing required target",
+			errorPolicy: "required",
+			failAction:  migrateTable,
+			wantErr:     "failed to write to target secondary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, secondary := newTestFlightService(), newTestFlightService()
+			defer primary.release()
+			defer secondary.release()
+			secondary.failAction = tt.failAction
+			c := newTestClient(t, "", map[string]any{
+				"targets": []map[string]any{
+					{"name": "primary", "addr": newTestFlightServer(t, primary)},
+					{
+						"name":            "secondary",
+						"addr":            newTestFlightServer(t, secondary),
+						"descriptor_path": []string{"archive"},
+						"error_policy":    tt.errorPolicy,
+					},
+				},
+			})
+			ctx := context.Background()
+
+			table := testTable("test_targets")
+			rec := testRecord(memory.DefaultAllocator, table, 10)
+			defer rec.Release()
+
+			res := make(chan message.WriteMessage, 2)
+			res <- &message.WriteMigrateTable{Table: table}
+			res <- &message.WriteInsert{Record: rec}
+			close(res)
+
+			err := c.Write(ctx, res)
+			require.NoError(t, c.Close(ctx))
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(10), primary.rows(table.Name))
+			assert.Equal(t, []string{"cloudquery", "arrowflight", table.Name}, primary.descriptors[table.Name].GetPath())
+			assert.Equal(t, tt.wantSecondary, secondary.rows(table.Name))
+			if tt.wantSecondary > 0 {
+				assert.Equal(t, []string{"archive", table.Name}, secondary.descriptors[table.Name].GetPath())
+			}
+		})
+	}
+}
+
+func TestClient_Routes(t *testing.T) {
+	aws, gcp := newTestFlightService(), newTestFlightService()
+	defer aws.release()
+	defer gcp.release()
+	overrides := map[string]any{
+		"targets": []map[string]any{
+			{"name": "aws", "addr": newTestFlightServer(t, aws)},
+			{"name": "gcp", "addr": newTestFlightServer(t, gcp)},
+		},
+		"routes": []map[string]any{
+			{"tables": []string{"aws_*"}, "target": "aws"},
+			{"source_name": "gcp", "target": "gcp"},
+		},
+	}
+	c := newTestClient(t, "", overrides)
+	ctx := context.Background()
+
+	awsTable := testTable("aws_instances")
+	sharedTable := testTable("shared_regions")
+	sourceTable := testTable("gcp_instances")
+	sourceTable.Columns = append(sourceTable.Columns, schema.CqSourceNameColumn)
+	awsRec := testRecord(memory.DefaultAllocator, awsTable, 10)
+	defer awsRec.Release()
+	sharedRec := testRecord(memory.DefaultAllocator, sharedTable, 5)
+	defer sharedRec.Release()
+	sourceRec := testSourceRecord(t, sourceTable, "gcp", 3)
+	defer sourceRec.Release()
+
+	res := make(chan message.WriteMessage, 6)
+	res <- &message.WriteMigrateTable{Table: awsTable}
+	res <- &message.WriteMigrateTable{Table: sharedTable}
+	res <- &message.WriteMigrateTable{Table: sourceTable}
+	res <- &message.WriteInsert{Record: awsRec}
+	res <- &message.WriteInsert{Record: sharedRec}
+	res <- &message.WriteInsert{Record: sourceRec}
+	close(res)
+
+	require.NoError(t, c.Write(ctx, res))
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, int64(10), aws.rows(awsTable.Name))
+	assert.Equal(t, int64(0), gcp.rows(awsTable.Name))
+	assert.Equal(t, int64(5), aws.rows(sharedTable.Name))
+	assert.Equal(t, int64(5), gcp.rows(sharedTable.Name))
+	assert.Equal(t, int64(0), aws.rows(sourceTable.Name))
+	assert.Equal(t, int64(3), gcp.rows(sourceTable.Name))
+	assert.Equal(t, 2, countActions(aws.actionTypes(), migrateTable))
+	assert.Equal(t, 2, countActions(gcp.actionTypes(), migrateTable))
+
+	reader := newTestClient(t, "", overrides)
+	defer reader.Close(ctx)
+	records := make(chan arrow.Record, 10)
+	require.NoError(t, reader.Read(ctx, awsTable, records))
+	close(records)
+	var rows int64
+	for rec := range records {
+		rows += rec.NumRows()
+		rec.Release()
+	}
+	assert.Equal(t, int64(10), rows)
+}
+
+func TestClient_RoutesWithoutSourceName(t *testing.T) {
+	aws, gcp := newTestFlightService(), newTestFlightService()
+	defer aws.release()
+	defer gcp.release()
+	c := newTestClient(t, "", map[string]any{
+		"targets": []map[string]any{
+			{"name": "aws", "addr": newTestFlightServer(t, aws)},
+			{"name": "gcp", "addr": newTestFlightServer(t, gcp)},
+		},
+		"routes": []map[string]any{
+			{"source_name": "gcp", "target": "gcp"},
+		},
+	})
+	ctx := context.Background()
+
+	// A read ignores the source name route without keeping the resolution for later writes.
+	sourceTable := testTable("gcp_instances")
+	sourceTable.Columns = append(sourceTable.Columns, schema.CqSourceNameColumn)
+	records := make(chan arrow.Record, 1)
+	require.Error(t, c.Read(ctx, sourceTable, records))
+
+	// The held back records of a table without a source name are sent once the limit is reached.
+	table := testTable("shared_regions")
+	rec := testRecord(memory.DefaultAllocator, table, 1)
+	defer rec.Release()
+	sourceRec := testSourceRecord(t, sourceTable, "gcp", 3)
+	defer sourceRec.Release()
+
+	res := make(chan message.WriteMessage)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Write(ctx, res)
+	}()
+	res <- &message.WriteMigrateTable{Table: sourceTable}
+	res <- &message.WriteInsert{Record: sourceRec}
+	for i := 0; i <= maxPendingMessages; i++ {
+		res <- &message.WriteInsert{Record: rec}
+	}
+	assert.Eventually(t, func() bool {
+		return aws.rows(table.Name) == maxPendingMessages+1 && gcp.rows(table.Name) == maxPendingMessages+1
+	}, 10*time.Second, 10*time.Millisecond)
+	close(res)
+	require.NoError(t, <-errCh)
+	require.NoError(t, c.Close(ctx))
+
+	assert.Equal(t, int64(0), aws.rows(sourceTable.Name))
+	assert.Equal(t, int64(3), gcp.rows(sourceTable.Name))
+}
+
+func testSourceRecord(t *testing.T, table *schema.Table, sourceName string, rows int) arrow.Record {
+	t.Helper()
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, table.ToArrowSchema())
+	defer builder.Release()
+
+	for i := 0; i < rows; i++ {
+		builder.Field(0).(*array.Int64Builder).Append(int64(i))
+		builder.Field(1).(*array.StringBuilder).Append("row")
+		builder.Field(2).(*array.StringBuilder).Append(sourceName)
+	}
+	return builder.NewRecord()
+}
+
+func countActions(actionTypes []string, actionType string) int {
+	n := 0
+	for _, t := range actionTypes {
+		if t == actionType {
+			n++
+		}
+	}
+	return n
+}
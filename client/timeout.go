@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The operations named by a TimeoutError, next to the action types.
+const (
+	operationHandshake     = "Handshake"
+	operationGetFlightInfo = "GetFlightInfo"
+	operationGetSchema     = "GetSchema"
+	operationListActions   = "ListActions"
+	operationDoGet         = "DoGet"
+	operationDoPut         = "DoPut"
+	operationDoExchange    = "DoExchange"
+	operationCloseDrain    = "close drain"
+)
+
+// TimeoutError is returned when a call to the ArrowFlight service exceeds its timeout. The table name is empty
+// for calls which don't concern a single table.
+type TimeoutError struct {
+	Operation string
+	TableName string
+	Timeout   time.Duration
+	Err       error
+}
+
+func (e *TimeoutError) Error() string {
+	if len(e.TableName) == 0 {
+		return fmt.Sprintf("%s timed out after %s: %v", e.Operation, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("%s of table %s timed out after %s: %v", e.Operation, e.TableName, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// withTimeout returns the context of an operation, which is cancelled once the timeout is exceeded.
+// A zero timeout doesn't set a deadline.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError returns a TimeoutError for the error of the operation if its context exceeded the timeout,
+// but the parent context is still active. Other errors are returned as they are.
+func timeoutError(parent, ctx context.Context, err error, operation, tableName string, timeout time.Duration) error {
+	if err == nil || timeout <= 0 || parent.Err() != nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &TimeoutError{
+		Operation: operation,
+		TableName: tableName,
+		Timeout:   timeout,
+		Err:       err,
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Timeouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		stall         string
+		timeouts      map[string]any
+		call          func(ctx context.Context, c *Client) error
+		wantOperation string
+		wantTimeout   time.Duration
+	}{
+		{
+			name:     "should time out an action with its action type timeout",
+			stall:    deleteRecord,
+			timeouts: map[string]any{"action": "1m", "actions": map[string]any{deleteRecord: "50ms"}},
+			call: func(ctx context.Context, c *Client) error {
+				return c.DeleteRecord(ctx, testDeleteRecord("test_timeouts"))
+			},
+			wantOperation: deleteRecord,
+			wantTimeout:   50 * time.Millisecond,
+		},
+		{
+			name:     "should time out GetFlightInfo",
+			stall:    operationGetFlightInfo,
+			timeouts: map[string]any{"get_flight_info": "50ms"},
+			call: func(ctx context.Context, c *Client) error {
+				return c.Read(ctx, testTable("test_timeouts"), make(chan arrow.Record, 1))
+			},
+			wantOperation: operationGetFlightInfo,
+			wantTimeout:   50 * time.Millisecond,
+		},
+		{
+			name:     "should time out GetSchema with the MigrateTable timeout",
+			stall:    operationGetSchema,
+			timeouts: map[string]any{"action": "1m", "actions": map[string]any{migrateTable: "50ms"}},
+			call: func(ctx context.Context, c *Client) error {
+				return c.MigrateTable(ctx, &message.WriteMigrateTable{Table: testTable("test_timeouts")})
+			},
+			wantOperation: operationGetSchema,
+			wantTimeout:   50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			defer server.release()
+			server.stall = tt.stall
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"timeouts": tt.timeouts})
+			ctx := context.Background()
+
+			err := tt.call(ctx, c)
+			var timeoutErr *TimeoutError
+			require.ErrorAs(t, err, &timeoutErr)
+			assert.Equal(t, tt.wantOperation, timeoutErr.Operation)
+			assert.Equal(t, "test_timeouts", timeoutErr.TableName)
+			assert.Equal(t, tt.wantTimeout, timeoutErr.Timeout)
+			require.NoError(t, c.Close(ctx))
+		})
+	}
+}
+
+func TestClient_TimeoutsCancelledParent(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	server.stall = deleteStale
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"timeouts": map[string]any{"action": "1m"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.doActionResults(ctx, deleteStale, "test_timeouts", nil)
+	require.Error(t, err)
+	var timeoutErr *TimeoutError
+	assert.NotErrorAs(t, err, &timeoutErr)
+	require.NoError(t, c.Close(context.Background()))
+}
+
+func TestWriter_WriteTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]any
+		// resent reports whether the batches written to the stalled stream are resent.
+		resent bool
+	}{
+		{
+			name:      "do put",
+			overrides: map[string]any{},
+		},
+		{
+			name:      "do exchange",
+			overrides: map[string]any{"write_transport": "do_exchange", "exchange_window_size": 100},
+			resent:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			defer server.release()
+			server.stallStreams = 1
+			addr := newTestFlightServer(t, server)
+			overrides := map[string]any{"timeouts": map[string]any{"write": "200ms"}}
+			for k, v := range tt.overrides {
+				overrides[k] = v
+			}
+			// Listing the address twice shortens the retry delay.
+			c := newTestClient(t, addr+","+addr, overrides)
+			ctx := context.Background()
+
+			// The stalled stream blocks the writes once the flow control windows are full.
+			table := testTable("test_write_timeout")
+			builder := array.NewRecordBuilder(memory.DefaultAllocator, table.ToArrowSchema())
+			for i := 0; i < 3; i++ {
+				builder.Field(0).(*array.Int64Builder).Append(int64(i))
+				builder.Field(1).(*array.StringBuilder).Append(strings.Repeat("x", 1<<20))
+			}
+			rec := builder.NewRecord()
+			builder.Release()
+			defer rec.Release()
+
+			const inserts = 20
+			for i := 0; i < inserts; i++ {
+				require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+			}
+			require.NoError(t, c.Close(ctx))
+
+			assert.Zero(t, server.stallStreams)
+			if tt.resent {
+				assert.Equal(t, int64(inserts*3), server.rows(table.Name))
+			} else {
+				assert.Positive(t, server.rows(table.Name))
+			}
+		})
+	}
+}
+
+func TestClient_CloseDrainConcurrent(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	// The streams don't finish while the PutResults are held, so every writer waits for the whole close drain.
+	server.holdResults = make(chan struct{})
+	defer close(server.holdResults)
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"timeouts": map[string]any{"close_drain": "300ms"}})
+	ctx := context.Background()
+
+	for _, name := range []string{"test_close_drain_1", "test_close_drain_2", "test_close_drain_3"} {
+		rec := testRecord(memory.DefaultAllocator, testTable(name), 1)
+		require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+		rec.Release()
+	}
+
+	start := time.Now()
+	require.NoError(t, c.closeWriters(ctx))
+	assert.Less(t, time.Since(start), 800*time.Millisecond)
+	assert.Empty(t, c.writers)
+	require.NoError(t, c.Close(ctx))
+}
+
+func TestTimeoutError(t *testing.T) {
+	err := &TimeoutError{Operation: deleteStale, TableName: "test_table", Timeout: time.Minute, Err: context.DeadlineExceeded}
+	assert.EqualError(t, err, "DeleteStale of table test_table timed out after 1m0s: context deadline exceeded")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = &TimeoutError{Operation: operationHandshake, Timeout: time.Second, Err: context.DeadlineExceeded}
+	assert.EqualError(t, err, "Handshake timed out after 1s: context deadline exceeded")
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const tracerName = "github.com/spangenberg/cq-destination-arrowflight/client"
+
+const (
+	spanDoAction      = "arrowflight.DoAction"
+	spanGetFlightInfo = "arrowflight.GetFlightInfo"
+	spanDoGet         = "arrowflight.DoGet"
+	spanWriterInit    = "arrowflight.Writer.init"
+	spanWriterWrite   = "arrowflight.Writer.write"
+	spanWriterClose   = "arrowflight.Writer.Close"
+	spanClientClose   = "arrowflight.Client.Close"
+)
+
+const (
+	attributeAction         = attribute.Key("arrowflight.action")
+	attributeAttempt        = attribute.Key("arrowflight.attempt")
+	attributeBytes          = attribute.Key("arrowflight.bytes")
+	attributeRows           = attribute.Key("arrowflight.rows")
+	attributeTableName      = attribute.Key("arrowflight.table_name")
+	attributeTransport      = attribute.Key("arrowflight.write_transport")
+	attributeGRPCStatusCode = attribute.Key("rpc.grpc.status_code")
+)
+
+// propagator injects the trace context into the gRPC metadata of every call. It doesn't depend on the global
+// propagator, which the plugin SDK doesn't set.
+var propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// startSpan starts a span with the tracer of the global tracer provider, which is set by the plugin SDK
+// when OpenTelemetry is enabled.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+// endSpan records the error and its gRPC code on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(attributeGRPCStatusCode.Int(int(grpcCode(err))))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// grpcCode returns the gRPC code of the error, mapping context errors to their codes.
+func grpcCode(err error) codes.Code {
+	if code := status.Code(err); code != codes.Unknown {
+		return code
+	}
+	return status.FromContextError(err).Code()
+}
+
+// metadataCarrier adapts the outgoing gRPC metadata to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+// Assert metadataCarrier implements propagation.TextMapCarrier interface.
+var _ propagation.TextMapCarrier = metadataCarrier(nil)
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTraceContext returns a context whose outgoing metadata carries the trace context of ctx.
+func injectTraceContext(ctx context.Context) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func traceUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(injectTraceContext(ctx), method, req, reply, cc, opts...)
+}
+
+func traceStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(injectTraceContext(ctx), desc, cc, method, opts...)
+}
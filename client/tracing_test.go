@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+)
+
+func TestClient_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), nil)
+	ctx := context.Background()
+
+	table := testTable("test_tracing")
+	rec := testRecord(memory.DefaultAllocator, table, 10)
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	close(res)
+	for r := range res {
+		r.Release()
+	}
+	require.NoError(t, c.Close(ctx))
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	for _, name := range []string{spanDoAction, spanGetFlightInfo, spanDoGet, spanWriterInit, spanWriterWrite, spanWriterClose, spanClientClose} {
+		assert.Contains(t, spans, name)
+	}
+
+	attributes := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+	write := attributes(spans[spanWriterWrite])
+	assert.Equal(t, table.Name, write[attributeTableName].AsString())
+	assert.Equal(t, int64(1), write[attributeAttempt].AsInt64())
+	assert.Equal(t, int64(10), write[attributeRows].AsInt64())
+	assert.Positive(t, write[attributeBytes].AsInt64())
+	assert.Equal(t, int64(codes.OK), write[attributeGRPCStatusCode].AsInt64())
+	assert.Equal(t, int64(10), attributes(spans[spanDoGet])[attributeRows].AsInt64())
+
+	// The trace context of the last action is propagated to the server.
+	action := spans[spanDoAction]
+	assert.Equal(t, migrateTable, attributes(action)[attributeAction].AsString())
+	traceparent := server.headers[len(server.headers)-1].Get("traceparent")
+	require.Len(t, traceparent, 1)
+	assert.Contains(t, traceparent[0], action.SpanContext.TraceID().String())
+	assert.Contains(t, traceparent[0], action.SpanContext.SpanID().String())
+
+	// Writers still open at Close are closed under the Client.Close span.
+	c = newTestClient(t, newTestFlightServer(t, server), nil)
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	exporter.Reset()
+	require.NoError(t, c.Close(ctx))
+	spans = make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	require.Contains(t, spans, spanWriterClose)
+	require.Contains(t, spans, spanClientClose)
+	assert.Equal(t, spans[spanClientClose].SpanContext.SpanID(), spans[spanWriterClose].Parent.SpanID())
+}
+
+func TestEndSpan_RecordsGRPCCode(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "test")
+	endSpan(span, context.Canceled)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Attributes, attributeGRPCStatusCode.Int(int(codes.Canceled)))
+	assert.Len(t, spans[0].Events, 1)
+}
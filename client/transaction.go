@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	beginSync    = "BeginSync"
+	commitSync   = "CommitSync"
+	rollbackSync = "RollbackSync"
+
+	// transactionIDHeader carries the transaction ID on every call made during a transactional sync.
+	transactionIDHeader = "cq-transaction-id"
+)
+
+// beginTransaction starts a transaction and returns a context tagging every call with its ID.
+func (c *Client) beginTransaction(ctx context.Context) (context.Context, error) {
+	c.logger.Info().Msg("begin sync")
+	body, err := c.doAction(ctx, beginSync, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to doAction: %w", err)
+	}
+	if len(body) == 0 {
+		return nil, errors.New("empty transaction id")
+	}
+
+	transactionID := string(body)
+	c.setTransactionID(transactionID)
+	c.logger.Info().Str("transactionId", transactionID).Msg("began sync")
+
+	return metadata.AppendToOutgoingContext(ctx, transactionIDHeader, transactionID), nil
+}
+
+// endTransaction flushes the writers and commits the transaction if the sync succeeded, or rolls it back otherwise.
+// A failed commit is rolled back as well, so the ArrowFlight service doesn't keep the transaction open.
+func (c *Client) endTransaction(ctx context.Context, syncErr error) error {
+	transactionID := c.currentTransactionID()
+	defer c.setTransactionID("")
+
+	if syncErr == nil {
+		syncErr = ctx.Err()
+	}
+	if syncErr == nil {
+		if syncErr = c.closeWriters(ctx); syncErr == nil {
+			c.logger.Info().Str("transactionId", transactionID).Msg("commit sync")
+			_, err := c.doAction(ctx, commitSync, "", []byte(transactionID))
+			if err == nil {
+				return nil
+			}
+			syncErr = fmt.Errorf("failed to commit sync: %w", err)
+		}
+	} else if err := c.closeWriters(ctx); err != nil {
+		syncErr = errors.Join(syncErr, err)
+	}
+
+	c.logger.Warn().Err(syncErr).Str("transactionId", transactionID).Msg("rollback sync")
+	if _, err := c.doAction(context.WithoutCancel(ctx), rollbackSync, "", []byte(transactionID)); err != nil {
+		return errors.Join(syncErr, fmt.Errorf("failed to rollback sync: %w", err))
+	}
+	return syncErr
+}
+
+// currentTransactionID returns the ID of the transaction of the running sync, or an empty string outside a transaction.
+// It is guarded by transactionMutex, as the writers read it while the transaction begins and ends.
+func (c *Client) currentTransactionID() string {
+	c.transactionMutex.RLock()
+	defer c.transactionMutex.RUnlock()
+
+	return c.transactionID
+}
+
+func (c *Client) setTransactionID(transactionID string) {
+	c.transactionMutex.Lock()
+	defer c.transactionMutex.Unlock()
+
+	c.transactionID = transactionID
+}
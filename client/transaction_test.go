@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unknownWriteMessage struct {
+	message.WriteMigrateTable
+}
+
+func TestClient_Transactional(t *testing.T) {
+	tests := []struct {
+		name        string
+		failAction  string
+		unknown     bool
+		wantActions []string
+		wantErr     bool
+	}{
+		{
+			name:        "should commit a successful sync",
+			wantActions: []string{beginSync, migrateTable, commitSync},
+		},
+		{
+			name:        "should rollback a failed sync",
+			unknown:     true,
+			wantActions: []string{beginSync, migrateTable, rollbackSync},
+			wantErr:     true,
+		},
+		{
+			name:        "should rollback a failed commit",
+			failAction:  commitSync,
+			wantActions: []string{beginSync, migrateTable, commitSync, rollbackSync},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestFlightService()
+			server.failAction = tt.failAction
+			defer server.release()
+			c := newTestClient(t, newTestFlightServer(t, server), map[string]any{"transactional": true})
+			ctx := context.Background()
+
+			table := testTable("test_transactional")
+			rec := testRecord(memory.DefaultAllocator, table, 10)
+			defer rec.Release()
+
+			res := make(chan message.WriteMessage, 3)
+			res <- &message.WriteMigrateTable{Table: table}
+			res <- &message.WriteInsert{Record: rec}
+			if tt.unknown {
+				res <- &unknownWriteMessage{}
+			}
+			close(res)
+
+			err := c.Write(ctx, res)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, c.Close(ctx))
+
+			assert.Equal(t, tt.wantActions, server.actionTypes())
+			assert.Equal(t, []string{"test-transaction"}, server.headers[2].Get(transactionIDHeader))
+			var cmd descriptorCommand
+			require.NoError(t, json.Unmarshal(server.descriptors[table.Name].GetCmd(), &cmd))
+			assert.Equal(t, "test-transaction", cmd.TransactionID)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+// recordConverter converts a record, returning a record which must be released.
+type recordConverter func(arrow.Record) (arrow.Record, error)
+
+// transformsRecords reports whether the tables and records are transformed before they are written to the ArrowFlight service.
+func (c *Client) transformsRecords() bool {
+	return c.filtersColumns() || len(c.masks) > 0 || c.nester != nil || c.normalizer != nil || c.compat != nil || c.namer != nil
+}
+
+// columnMask returns the mask of the column of the table, or nil if the column isn't masked. Primary key columns
+// can only be hashed, as the other transforms don't keep the keys unique, so an error is returned for them.
+func (c *Client) columnMask(tableName string, column schema.Column) (*mask, error) {
+	if strings.HasPrefix(column.Name, cqColumnPrefix) {
+		return nil, nil
+	}
+	i := c.spec.ColumnTransform(tableName, column.Name)
+	if i < 0 || i >= len(c.masks) {
+		return nil, nil
+	}
+	m := c.masks[i]
+	if column.PrimaryKey && !m.hashes() {
+		return nil, fmt.Errorf("the %s transform can't mask the primary key column %s of table %s", m.Type, column.Name, tableName)
+	}
+	return m, nil
+}
+
+// maskTable returns the table with the types of the masked columns. The table is returned as is if no column is masked.
+func (c *Client) maskTable(table *schema.Table) (*schema.Table, error) {
+	var masked *schema.Table
+	for i, column := range table.Columns {
+		m, err := c.columnMask(table.Name, column)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+		dataType, err := m.dataType(column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mask column %s of table %s: %w", column.Name, table.Name, err)
+		}
+		if masked == nil {
+			masked = table.Copy(nil)
+		}
+		masked.Columns[i].Type = dataType
+	}
+	if masked == nil {
+		return table, nil
+	}
+	return masked, nil
+}
+
+// transformTable returns the table as it is stored by the ArrowFlight service, with the types of the masked columns,
+// without the filtered columns, with the rewritten nested columns and with the normalized types. The table and its
+// columns aren't renamed yet, see namer.table.
+func (c *Client) transformTable(table *schema.Table) (*schema.Table, error) {
+	masked, err := c.maskTable(table)
+	if err != nil {
+		return nil, err
+	}
+	return c.normalizer.table(c.nester.table(c.filterTable(masked))), nil
+}
+
+// transformRecord returns the record of the table as it is written to the ArrowFlight service, with the values
+// of the masked columns, without the filtered columns, with the rewritten nested columns, with the normalized values,
+// with the types rewritten by `type_compatibility` and with the renamed columns. The returned record must be released.
+func (c *Client) transformRecord(table *schema.Table, rec arrow.Record) (arrow.Record, error) {
+	masked, err := c.maskRecord(table, rec)
+	if err != nil {
+		return nil, err
+	}
+	defer masked.Release()
+	filtered := c.filterRecord(table, masked)
+	defer filtered.Release()
+	nested, err := c.nester.record(c.allocator, filtered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite nested columns of table %s: %w", table.Name, err)
+	}
+	defer nested.Release()
+	converted, err := c.convertRecord(table.Name, nested)
+	if err != nil {
+		return nil, err
+	}
+	defer converted.Release()
+	return c.namer.record(table.Name, converted)
+}
+
+// convertRecord returns the record with the normalized values and with the types rewritten by `type_compatibility`.
+// It is applied to the written records and the records of the delete predicates. The returned record must be released.
+func (c *Client) convertRecord(tableName string, rec arrow.Record) (arrow.Record, error) {
+	normalized, truncated, err := c.normalizer.record(c.allocator, rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize record of table %s: %w", tableName, err)
+	}
+	defer normalized.Release()
+	if truncated > 0 {
+		c.logger.Warn().Str("tableName", tableName).Int64("values", truncated).Msg("truncated values losing precision during normalization")
+	}
+	return c.compat.record(c.allocator, normalized)
+}
+
+// readConverter returns the converter of the records of the table read from the ArrowFlight service, or nil if
+// they are read as they are stored. The renamed columns, the types rewritten by `type_compatibility` and the nested
+// columns are restored, and the filtered columns are read as nulls. The masked and normalized columns are read as they are stored.
+func (c *Client) readConverter(table *schema.Table) (recordConverter, error) {
+	if !c.filtersColumns() && c.nester == nil && c.compat == nil && c.namer == nil {
+		return nil, nil
+	}
+	masked, err := c.maskTable(table)
+	if err != nil {
+		return nil, err
+	}
+	var sc *arrow.Schema
+	if c.filterTable(masked) != masked {
+		sc = masked.ToArrowSchema()
+	}
+	var stored *schema.Table
+	if c.namer != nil {
+		if stored, err = c.transformTable(table); err != nil {
+			return nil, err
+		}
+	}
+	return func(rec arrow.Record) (arrow.Record, error) {
+		if stored != nil {
+			rec = c.namer.restoreRecord(stored, rec)
+		} else {
+			rec.Retain()
+		}
+		if c.compat != nil {
+			restored, err := c.compat.restoreRecord(c.allocator, rec)
+			rec.Release()
+			if err != nil {
+				return nil, err
+			}
+			rec = restored
+		}
+		if c.nester != nil {
+			restored, err := c.nester.restoreRecord(c.allocator, masked, rec)
+			rec.Release()
+			if err != nil {
+				return nil, err
+			}
+			rec = restored
+		}
+		if sc != nil {
+			defer rec.Release()
+			return restoreRecord(c.allocator, sc, rec), nil
+		}
+		return rec, nil
+	}, nil
+}
+
+// maskRecord returns the record with the values of the masked columns. The returned record must be released.
+func (c *Client) maskRecord(table *schema.Table, rec arrow.Record) (arrow.Record, error) {
+	return c.maskColumns(table.Name, rec, func(i int) schema.Column {
+		return table.Columns[i]
+	})
+}
+
+// maskPredicateRecord returns the record of a delete predicate with the values of the masked columns, so clear-text
+// values of masked columns aren't sent and hashed values match the stored ones. The columns are read from the fields
+// of the record, as the table of a delete has none. The returned record must be released.
+func (c *Client) maskPredicateRecord(tableName string, rec arrow.Record) (arrow.Record, error) {
+	return c.maskColumns(tableName, rec, func(i int) schema.Column {
+		return schema.NewColumnFromArrowField(rec.Schema().Field(i))
+	})
+}
+
+// maskColumns returns the record with the values of the masked columns, where column returns the column of the
+// table of the i-th field of the record. The returned record must be released.
+func (c *Client) maskColumns(tableName string, rec arrow.Record, column func(i int) schema.Column) (arrow.Record, error) {
+	var fields []arrow.Field
+	var columns []arrow.Array
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for i := 0; i < int(rec.NumCols()); i++ {
+		col := column(i)
+		m, err := c.columnMask(tableName, col)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+		if columns == nil {
+			fields = rec.Schema().Fields()
+			columns = make([]arrow.Array, rec.NumCols())
+			for j, arr := range rec.Columns() {
+				arr.Retain()
+				columns[j] = arr
+			}
+		}
+		masked, err := m.apply(c.allocator, rec.Column(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to mask column %s of table %s: %w", col.Name, tableName, err)
+		}
+		columns[i].Release()
+		columns[i] = masked
+		fields[i].Type = masked.DataType()
+	}
+	if columns == nil {
+		rec.Retain()
+		return rec, nil
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows()), nil
+}
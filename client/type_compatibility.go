@@ -0,0 +1,286 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+// metadataOriginalType is the field metadata naming the type a field was rewritten from, so it can be rewritten back when reading.
+const metadataOriginalType = "arrowflight:original_type"
+
+const (
+	originalTypeLargeString = "large_string"
+	originalTypeLargeBinary = "large_binary"
+)
+
+// typeCompat rewrites the CloudQuery extension types and the large types to types every ArrowFlight service understands.
+// A nil typeCompat doesn't rewrite anything.
+type typeCompat struct {
+	extensionTypes map[string]string
+}
+
+func newTypeCompat(s spec.TypeCompatibility) *typeCompat {
+	if !s.Enabled {
+		return nil
+	}
+	return &typeCompat{extensionTypes: s.ExtensionTypes()}
+}
+
+// dataType returns the type written instead of dt and the name of the original type, which is empty if dt isn't rewritten.
+func (t *typeCompat) dataType(dt arrow.DataType) (arrow.DataType, string) {
+	switch dt := dt.(type) {
+	case *arrow.LargeStringType:
+		return arrow.BinaryTypes.String, originalTypeLargeString
+	case *arrow.LargeBinaryType:
+		return arrow.BinaryTypes.Binary, originalTypeLargeBinary
+	case arrow.ExtensionType:
+		compatibleType, ok := t.extensionTypes[dt.ExtensionName()]
+		if !ok {
+			return dt, ""
+		}
+		if compatibleType == spec.CompatibleTypeString {
+			return arrow.BinaryTypes.String, dt.ExtensionName()
+		}
+		return dt.StorageType(), dt.ExtensionName()
+	default:
+		return dt, ""
+	}
+}
+
+// originalType returns the type named by the field metadata written by field.
+func originalType(name string) (arrow.DataType, bool) {
+	switch name {
+	case originalTypeLargeString:
+		return arrow.BinaryTypes.LargeString, true
+	case originalTypeLargeBinary:
+		return arrow.BinaryTypes.LargeBinary, true
+	case "uuid":
+		return types.NewUUIDType(), true
+	case "json":
+		return types.NewJSONType(), true
+	case "inet":
+		return types.NewInetType(), true
+	case "mac":
+		return types.NewMACType(), true
+	default:
+		return nil, false
+	}
+}
+
+// field returns the field with the rewritten type, recording the original type in the field metadata.
+// The elements of lists are rewritten as well.
+func (t *typeCompat) field(f arrow.Field) arrow.Field {
+	switch dt := f.Type.(type) {
+	case *arrow.ListType:
+		f.Type = arrow.ListOfField(t.field(dt.ElemField()))
+	case *arrow.LargeListType:
+		f.Type = arrow.LargeListOfField(t.field(dt.ElemField()))
+	default:
+		compatibleType, name := t.dataType(f.Type)
+		if len(name) == 0 {
+			return f
+		}
+		keys, values := append(f.Metadata.Keys(), metadataOriginalType), append(f.Metadata.Values(), name)
+		f.Type, f.Metadata = compatibleType, arrow.NewMetadata(keys, values)
+	}
+	return f
+}
+
+// schema returns the schema with the rewritten types.
+func (t *typeCompat) schema(sc *arrow.Schema) *arrow.Schema {
+	if t == nil {
+		return sc
+	}
+	fields := sc.Fields()
+	for i, f := range fields {
+		fields[i] = t.field(f)
+	}
+	metadata := sc.Metadata()
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// table returns the table with the rewritten column types, as the ArrowFlight service reports it.
+func (t *typeCompat) table(table *schema.Table) *schema.Table {
+	if t == nil {
+		return table
+	}
+	compatible := table.Copy(nil)
+	for i, column := range compatible.Columns {
+		compatible.Columns[i].Type = t.field(arrow.Field{Type: column.Type}).Type
+	}
+	return compatible
+}
+
+// record returns the record with the rewritten types. The returned record must be released.
+func (t *typeCompat) record(mem memory.Allocator, rec arrow.Record) (arrow.Record, error) {
+	if t == nil {
+		rec.Retain()
+		return rec, nil
+	}
+	sc := t.schema(rec.Schema())
+	columns := make([]arrow.Array, 0, rec.NumCols())
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for i, column := range rec.Columns() {
+		compatible, err := convertArray(mem, column, sc.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite column %s: %w", sc.Field(i).Name, err)
+		}
+		columns = append(columns, compatible)
+	}
+	return array.NewRecord(sc, columns, rec.NumRows()), nil
+}
+
+// restoreRecord returns the record read from the ArrowFlight service with the original types recorded in the field metadata.
+// Fields without the metadata are kept as they are. The returned record must be released.
+func (t *typeCompat) restoreRecord(mem memory.Allocator, rec arrow.Record) (arrow.Record, error) {
+	fields := rec.Schema().Fields()
+	columns := make([]arrow.Array, 0, rec.NumCols())
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+	for i, column := range rec.Columns() {
+		var err error
+		if fields[i], column, err = restoreArray(mem, column, fields[i]); err != nil {
+			return nil, fmt.Errorf("failed to restore column %s: %w", fields[i].Name, err)
+		}
+		columns = append(columns, column)
+	}
+	metadata := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &metadata), columns, rec.NumRows()), nil
+}
+
+// convertArray rewrites the array to the type of the field returned by typeCompat.field. The returned array must be released.
+func convertArray(mem memory.Allocator, arr arrow.Array, f arrow.Field) (arrow.Array, error) {
+	if arrow.TypeEqual(arr.DataType(), f.Type) {
+		arr.Retain()
+		return arr, nil
+	}
+	switch arr := arr.(type) {
+	case array.ListLike:
+		elemField := f.Type.(arrow.ListLikeType).ElemField()
+		values, err := convertArray(mem, arr.ListValues(), elemField)
+		if err != nil {
+			return nil, err
+		}
+		defer values.Release()
+		return withListValues(arr, f.Type, values), nil
+	case array.ExtensionArray:
+		if arrow.TypeEqual(arr.Storage().DataType(), f.Type) {
+			arr.Storage().Retain()
+			return arr.Storage(), nil
+		}
+	}
+
+	builder := array.NewBuilder(mem, f.Type)
+	defer builder.Release()
+	builder.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		switch builder := builder.(type) {
+		case *array.StringBuilder:
+			if v, ok := stringOrBinaryValue(arr, i); ok {
+				builder.Append(v)
+			} else {
+				builder.Append(arr.ValueStr(i))
+			}
+		case *array.BinaryBuilder:
+			v, ok := stringOrBinaryValue(arr, i)
+			if !ok {
+				return nil, fmt.Errorf("can't rewrite %s to %s", arr.DataType(), f.Type)
+			}
+			builder.AppendString(v)
+		default:
+			return nil, fmt.Errorf("can't rewrite %s to %s", arr.DataType(), f.Type)
+		}
+	}
+	return builder.NewArray(), nil
+}
+
+// restoreArray rewrites the array back to the original type recorded in the field metadata, returning the restored field.
+// The returned array must be released.
+func restoreArray(mem memory.Allocator, arr arrow.Array, f arrow.Field) (arrow.Field, arrow.Array, error) {
+	if list, ok := arr.(array.ListLike); ok {
+		var elemField arrow.Field
+		var values arrow.Array
+		var err error
+		if elemField, values, err = restoreArray(mem, list.ListValues(), f.Type.(arrow.ListLikeType).ElemField()); err != nil {
+			return f, nil, err
+		}
+		defer values.Release()
+		switch f.Type.(type) {
+		case *arrow.ListType:
+			f.Type = arrow.ListOfField(elemField)
+		case *arrow.LargeListType:
+			f.Type = arrow.LargeListOfField(elemField)
+		default:
+			arr.Retain()
+			return f, arr, nil
+		}
+		return f, withListValues(list, f.Type, values), nil
+	}
+
+	name, ok := f.Metadata.GetValue(metadataOriginalType)
+	if !ok {
+		arr.Retain()
+		return f, arr, nil
+	}
+	dt, ok := originalType(name)
+	if !ok {
+		arr.Retain()
+		return f, arr, nil
+	}
+	if i := f.Metadata.FindKey(metadataOriginalType); i >= 0 {
+		keys, values := f.Metadata.Keys(), f.Metadata.Values()
+		f.Metadata = arrow.NewMetadata(append(keys[:i:i], keys[i+1:]...), append(values[:i:i], values[i+1:]...))
+	}
+	f.Type = dt
+
+	if ext, ok := dt.(arrow.ExtensionType); ok && arrow.TypeEqual(ext.StorageType(), arr.DataType()) {
+		return f, array.NewExtensionArrayWithStorage(ext, arr), nil
+	}
+	builder := array.NewBuilder(mem, dt)
+	defer builder.Release()
+	builder.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		v, ok := stringOrBinaryValue(arr, i)
+		if !ok {
+			return f, nil, fmt.Errorf("can't restore %s from %s", dt, arr.DataType())
+		}
+		if binaryBuilder, ok := builder.(*array.BinaryBuilder); ok {
+			binaryBuilder.AppendString(v)
+			continue
+		}
+		if err := builder.AppendValueFromString(v); err != nil {
+			return f, nil, fmt.Errorf("failed to restore %s: %w", dt, err)
+		}
+	}
+	return f, builder.NewArray(), nil
+}
+
+// withListValues returns the list array with its values replaced. The returned array must be released.
+func withListValues(list array.ListLike, dt arrow.DataType, values arrow.Array) arrow.Array {
+	data := list.Data()
+	listData := array.NewData(dt, data.Len(), data.Buffers(), []arrow.ArrayData{values.Data()}, data.NullN(), data.Offset())
+	defer listData.Release()
+	return array.MakeFromData(listData)
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+func testCompatTable(name string) *schema.Table {
+	return &schema.Table{
+		Name: name,
+		Columns: schema.ColumnList{
+			{Name: "id", Type: types.NewUUIDType(), PrimaryKey: true},
+			{Name: "document", Type: types.NewJSONType()},
+			{Name: "ip", Type: types.NewInetType()},
+			{Name: "mac", Type: types.NewMACType()},
+			{Name: "description", Type: arrow.BinaryTypes.LargeString},
+			{Name: "tags", Type: arrow.ListOf(types.NewUUIDType())},
+		},
+	}
+}
+
+func testCompatRecord(t *testing.T, mem memory.Allocator, table *schema.Table) arrow.Record {
+	t.Helper()
+
+	builder := array.NewRecordBuilder(mem, table.ToArrowSchema())
+	defer builder.Release()
+
+	for _, id := range []string{"0f0e5d5e-8f5c-4a5f-9e3c-1a2b3c4d5e6f", "6a4f2a1e-3b2c-4d5e-8f9a-0b1c2d3e4f5a"} {
+		require.NoError(t, builder.Field(0).AppendValueFromString(id))
+		require.NoError(t, builder.Field(1).AppendValueFromString(`{"key":"value"}`))
+		require.NoError(t, builder.Field(2).AppendValueFromString("192.168.0.0/24"))
+		require.NoError(t, builder.Field(3).AppendValueFromString("00:1a:2b:3c:4d:5e"))
+		require.NoError(t, builder.Field(4).AppendValueFromString("description"))
+		tags := builder.Field(5).(*array.ListBuilder)
+		tags.Append(true)
+		require.NoError(t, tags.ValueBuilder().AppendValueFromString(id))
+	}
+	builder.Field(0).AppendNull()
+	for i := 1; i < len(table.Columns); i++ {
+		builder.Field(i).AppendNull()
+	}
+	return builder.NewRecord()
+}
+
+func TestTypeCompat_Record(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      spec.TypeCompatibility
+		wantTypes []arrow.DataType
+	}{
+		{
+			name: "should rewrite to strings",
+			spec: spec.TypeCompatibility{Enabled: true},
+			wantTypes: []arrow.DataType{
+				arrow.BinaryTypes.String,
+				arrow.BinaryTypes.String,
+				arrow.BinaryTypes.String,
+				arrow.BinaryTypes.String,
+				arrow.BinaryTypes.String,
+				arrow.ListOf(arrow.BinaryTypes.String),
+			},
+		},
+		{
+			name: "should rewrite to storage types",
+			spec: spec.TypeCompatibility{Enabled: true, UUID: "fixed_size_binary", JSON: "binary", Inet: "binary", MAC: "binary"},
+			wantTypes: []arrow.DataType{
+				&arrow.FixedSizeBinaryType{ByteWidth: 16},
+				arrow.BinaryTypes.Binary,
+				arrow.BinaryTypes.Binary,
+				arrow.BinaryTypes.Binary,
+				arrow.BinaryTypes.String,
+				arrow.ListOf(&arrow.FixedSizeBinaryType{ByteWidth: 16}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+			defer mem.AssertSize(t, 0)
+
+			tt.spec.SetDefaults()
+			compat := newTypeCompat(tt.spec)
+			table := testCompatTable("test_compat")
+			rec := testCompatRecord(t, mem, table)
+			defer rec.Release()
+
+			compatible, err := compat.record(mem, rec)
+			require.NoError(t, err)
+			defer compatible.Release()
+			for i, want := range tt.wantTypes {
+				assert.Truef(t, arrow.TypeEqual(want, compatible.Column(i).DataType()), "column %d: want %s, got %s", i, want, compatible.Column(i).DataType())
+				assert.Truef(t, arrow.TypeEqual(want, compat.table(table).Columns[i].Type), "table column %d: want %s, got %s", i, want, compat.table(table).Columns[i].Type)
+			}
+
+			restored, err := compat.restoreRecord(mem, compatible)
+			require.NoError(t, err)
+			defer restored.Release()
+			assert.True(t, restored.Schema().Equal(rec.Schema()), "want %s, got %s", rec.Schema(), restored.Schema())
+			assert.True(t, array.RecordEqual(rec, restored))
+		})
+	}
+}
+
+func TestTypeCompat_Disabled(t *testing.T) {
+	compat := newTypeCompat(spec.TypeCompatibility{})
+	require.Nil(t, compat)
+
+	table := testCompatTable("test_compat")
+	rec := testCompatRecord(t, memory.DefaultAllocator, table)
+	defer rec.Release()
+
+	compatible, err := compat.record(memory.DefaultAllocator, rec)
+	require.NoError(t, err)
+	defer compatible.Release()
+	assert.Same(t, rec, compatible)
+	assert.Same(t, table, compat.table(table))
+}
+
+func TestClient_TypeCompatibility(t *testing.T) {
+	server := newTestFlightService()
+	defer server.release()
+	c := newTestClient(t, newTestFlightServer(t, server), map[string]any{
+		"type_compatibility": map[string]any{"enabled": true},
+	})
+	ctx := context.Background()
+
+	table := testCompatTable("test_type_compatibility")
+	rec := testCompatRecord(t, memory.DefaultAllocator, table)
+	defer rec.Release()
+
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	require.NoError(t, c.Insert(ctx, &message.WriteInsert{Record: rec}))
+	require.NoError(t, c.closeWriters(ctx))
+
+	migrated := server.migratedSchema(t, table.Name)
+	assert.True(t, arrow.TypeEqual(arrow.BinaryTypes.String, migrated.Field(0).Type))
+	originalType, _ := migrated.Field(0).Metadata.GetValue(metadataOriginalType)
+	assert.Equal(t, "uuid", originalType)
+	assert.True(t, arrow.TypeEqual(arrow.BinaryTypes.String, server.schemas[table.Name].Field(0).Type))
+
+	// A second migration of the unchanged table is skipped.
+	require.NoError(t, c.MigrateTable(ctx, &message.WriteMigrateTable{Table: table}))
+	assert.Equal(t, 1, countActions(server.actionTypes(), migrateTable))
+
+	res := make(chan arrow.Record, 10)
+	require.NoError(t, c.Read(ctx, table, res))
+	close(res)
+	var rows int64
+	for r := range res {
+		assert.True(t, array.RecordEqual(rec, r))
+		rows += r.NumRows()
+		r.Release()
+	}
+	assert.Equal(t, rec.NumRows(), rows)
+}
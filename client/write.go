@@ -3,33 +3,74 @@ package client
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/cloudquery/plugin-sdk/v4/message"
 )
 
-func (c *Client) Write(ctx context.Context, res <-chan message.WriteMessage) error {
-	for r := range res {
-		switch m := r.(type) {
-		case *message.WriteMigrateTable:
-			if err := c.MigrateTable(ctx, m); err != nil {
-				return fmt.Errorf("failed to migrate table %s: %w", m.Table.Name, err)
-			}
-		case *message.WriteInsert:
-			if err := c.Insert(ctx, m); err != nil {
-				return fmt.Errorf("failed to insert record: %w", err)
+func (c *Client) Write(ctx context.Context, res <-chan message.WriteMessage) (err error) {
+	if len(c.targets) > 0 {
+		return c.writeTargets(ctx, res)
+	}
+
+	if c.spec.Transactional && c.dryRun == nil {
+		if ctx, err = c.beginTransaction(ctx); err != nil {
+			return fmt.Errorf("failed to begin sync: %w", err)
+		}
+		defer func() {
+			err = c.endTransaction(ctx, err)
+		}()
+	}
+
+	// Buffered deletes are sent at the end of the sync, or dropped if it fails.
+	defer c.deletes.discard()
+	var flushDeletes <-chan time.Time
+	if interval := c.spec.DeleteRecordBatchInterval.Duration(); c.deletes != nil && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		flushDeletes = ticker.C
+	}
+
+	for {
+		select {
+		case <-flushDeletes:
+			if err := c.deletes.flushAll(ctx); err != nil {
+				return fmt.Errorf("failed to flush delete records: %w", err)
 			}
-		case *message.WriteDeleteStale:
-			if err := c.DeleteStale(ctx, m); err != nil {
-				return fmt.Errorf("failed to delete stale records: %w", err)
+		case r, ok := <-res:
+			if !ok {
+				if err := c.deletes.flushAll(ctx); err != nil {
+					return fmt.Errorf("failed to flush delete records: %w", err)
+				}
+				return nil
 			}
-		case *message.WriteDeleteRecord:
-			if err := c.DeleteRecord(ctx, m); err != nil {
-				return fmt.Errorf("failed to delete record: %w", err)
+			if err := c.writeMessage(ctx, r); err != nil {
+				return err
 			}
-		default:
-			return fmt.Errorf("unhandled message type: %T", m)
 		}
 	}
+}
 
+func (c *Client) writeMessage(ctx context.Context, r message.WriteMessage) error {
+	switch m := r.(type) {
+	case *message.WriteMigrateTable:
+		if err := c.MigrateTable(ctx, m); err != nil {
+			return fmt.Errorf("failed to migrate table %s: %w", m.Table.Name, err)
+		}
+	case *message.WriteInsert:
+		if err := c.Insert(ctx, m); err != nil {
+			return fmt.Errorf("failed to insert record: %w", err)
+		}
+	case *message.WriteDeleteStale:
+		if err := c.DeleteStale(ctx, m); err != nil {
+			return fmt.Errorf("failed to delete stale records: %w", err)
+		}
+	case *message.WriteDeleteRecord:
+		if err := c.DeleteRecord(ctx, m); err != nil {
+			return fmt.Errorf("failed to delete record: %w", err)
+		}
+	default:
+		return fmt.Errorf("unhandled message type: %T", m)
+	}
 	return nil
 }
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
+)
+
+const (
+	// metadataWriteMode is added to the schema metadata sent with MigrateTable.
+	metadataWriteMode = "cq:write_mode"
+)
+
+// writeMode returns the write mode of the table. Without an explicit `write_mode` it is inferred
+// from the primary keys, as the CLI removes them in append mode.
+func (c *Client) writeMode(table *schema.Table) string {
+	if len(c.spec.WriteMode) > 0 {
+		return c.spec.WriteMode
+	}
+	if len(table.PrimaryKeys()) > 0 {
+		return spec.WriteModeOverwrite
+	}
+	return spec.WriteModeAppend
+}
+
+// withSchemaMetadata returns a copy of the schema with the given metadata added.
+func withSchemaMetadata(sc *arrow.Schema, metadata map[string]string) *arrow.Schema {
+	md := make(map[string]string, sc.Metadata().Len()+len(metadata))
+	for i, key := range sc.Metadata().Keys() {
+		md[key] = sc.Metadata().Values()[i]
+	}
+	for key, value := range metadata {
+		md[key] = value
+	}
+	schemaMd := arrow.MetadataFrom(md)
+	return arrow.NewSchema(sc.Fields(), &schemaMd)
+}
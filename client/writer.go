@@ -1,11 +1,11 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
@@ -15,43 +15,122 @@ import (
 	"github.com/cloudquery/plugin-sdk/v4/schema"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/spangenberg/cq-destination-arrowflight/client/spec"
 )
 
 const writeTimeout = 10 * time.Second
 const maxRetries = 3
 
+// recordBatch is a record queued for writing. The sequence is only set for the DoExchange transport.
+type recordBatch struct {
+	sequence uint64
+	size     int64
+	record   arrow.Record
+}
+
 type Writer struct {
-	client            *Client
-	cancel            context.CancelFunc
-	flightDoPutClient flight.FlightService_DoPutClient
-	flightWriter      *flight.Writer
-	tableName         string
+	client                 *Client
+	cancel                 context.CancelFunc
+	exchange               *exchangeWindow
+	streamDone             chan struct{}
+	flightDoExchangeClient flight.FlightService_DoExchangeClient
+	flightDoPutClient      flight.FlightService_DoPutClient
+	flightWriter           *flight.Writer
+	inFlight               *inFlightQueue
+	inFlightLimiter        *inFlightLimiter
+	// streamCancelled is set when the write timeout cancelled the stream after the batch was written, so the next
+	// write creates a new stream.
+	streamCancelled bool
+	tableName       string
 }
 
 func NewWriter(client *Client, tableName string) *Writer {
-	return &Writer{
-		client:    client,
-		tableName: tableName,
+	w := &Writer{
+		client:          client,
+		inFlightLimiter: newInFlightLimiter(client.spec.MaxTableInFlightBatches, client.spec.MaxTableInFlightBytes),
+		tableName:       tableName,
 	}
+	if client.spec.WriteTransport == spec.WriteTransportDoExchange {
+		w.exchange = newExchangeWindow(client.spec.ExchangeWindowSize, client.allocator)
+	}
+	return w
 }
 
-func (w *Writer) Close() error {
-	if w.flightWriter != nil {
+func (w *Writer) Close(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, spanWriterClose, attributeTableName.String(w.tableName))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if w.streamCancelled && w.exchange != nil {
+		// The write timeout cancelled the stream after the last batch was written, so the unacknowledged batches
+		// are resent on a new stream.
+		batches := w.exchange.unacked(math.MaxUint64)
+		if len(batches) > 0 {
+			err := w.reinit(ctx, recordBatch{sequence: math.MaxUint64, record: batches[0].record})
+			for _, batch := range batches {
+				batch.record.Release()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to reinitialize writer after write timeout: %w", err)
+			}
+		}
+	}
+
+	// A stream cancelled by the write timeout has nothing left to close.
+	if w.flightWriter != nil && !w.streamCancelled {
 		if err := w.flightWriter.Close(); err != nil {
 			return fmt.Errorf("failed to close flight writer: %w", err)
 		}
 	}
 
-	if w.flightDoPutClient != nil {
+	if w.flightDoPutClient != nil && !w.streamCancelled {
 		if err := w.flightDoPutClient.CloseSend(); err != nil {
 			return fmt.Errorf("failed to close flight do put client: %w", err)
 		}
+
+		// Wait for the server to finish the stream before cancelling it, otherwise batches in transit are lost.
+		timeout := w.client.spec.Timeouts.CloseDrain.Duration()
+		select {
+		case <-w.streamDone:
+		case <-time.After(timeout):
+			w.client.logger.Warn().Str("table", w.tableName).Dur("timeout", timeout).Msg("timed out waiting for do put stream to finish")
+		}
+	}
+
+	if w.flightDoExchangeClient != nil && !w.streamCancelled {
+		if err := w.flightDoExchangeClient.CloseSend(); err != nil {
+			return fmt.Errorf("failed to close flight do exchange client: %w", err)
+		}
+	}
+
+	if w.exchange != nil {
+		defer func() {
+			w.releaseInFlight(w.exchange.release())
+		}()
+
+		timeout := w.client.spec.Timeouts.CloseDrain.Duration()
+		// The drain isn't cut short if the caller is cancelled, only by its own timeout.
+		parent := context.WithoutCancel(ctx)
+		drainCtx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		if err := w.exchange.drain(drainCtx, w.streamDone); err != nil {
+			if w.cancel != nil {
+				w.cancel()
+			}
+			return fmt.Errorf("failed to drain exchange window: %w", timeoutError(parent, drainCtx, err, operationCloseDrain, w.tableName, timeout))
+		}
 	}
 
 	if w.cancel != nil {
 		w.cancel()
 	}
 
+	if w.inFlight != nil {
+		w.releaseInFlight(w.inFlight.clear())
+	}
+
 	return nil
 }
 
@@ -59,19 +138,64 @@ func (w *Writer) Write(ctx context.Context, msg *message.WriteInsert) error {
 	var size int
 	{
 		var err error
-		if size, err = recordSize(msg.Record); err != nil {
+		if size, err = w.client.recordSize(msg.Record); err != nil {
 			return fmt.Errorf("failed to calculate record size: %w", err)
 		}
 	}
 	if size > w.client.spec.MaxCallSendMsgSize {
 		w.client.logger.Warn().Msg("record size exceeds max call send msg size, skipping write")
+		w.client.metrics.recordSkipped(ctx, w.tableName)
 		return nil
 	}
 
-	return w.writeWithRetries(ctx, msg.Record, 1)
+	// The record counts towards the memory limit until it was written, or acknowledged with DoExchange.
+	if err := w.client.allocator.acquire(ctx, int64(size)); err != nil {
+		return fmt.Errorf("failed to wait for memory: %w", err)
+	}
+
+	batch := recordBatch{record: msg.Record, size: int64(size)}
+	if w.exchange == nil {
+		defer w.client.allocator.unreserve(batch.size)
+	} else {
+		if err := w.acquireInFlight(ctx, batch.size); err != nil {
+			w.client.allocator.unreserve(batch.size)
+			return fmt.Errorf("failed to wait for in-flight batches: %w", err)
+		}
+
+		var err error
+		for attempt := 1; ; attempt++ {
+			batch.sequence, err = w.exchange.push(ctx, msg.Record, batch.size, w.streamDone)
+			if !errors.Is(err, errExchangeStreamEnded) || attempt > maxRetries {
+				break
+			}
+			w.client.logger.Warn().Str("table", w.tableName).Int("attempt", attempt).Msg("do exchange stream ended with a full window, reconnecting")
+			if err = w.reconnectExchange(ctx, msg.Record, attempt); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			w.releaseInFlight(1, batch.size)
+			w.client.allocator.unreserve(batch.size)
+			return fmt.Errorf("failed to add record to exchange window: %w", err)
+		}
+	}
+
+	start := time.Now()
+	if err := w.writeWithRetries(ctx, batch, 1); err != nil {
+		return err
+	}
+	w.client.metrics.recordWrite(ctx, w.tableName, msg.Record.NumRows(), batch.size, time.Since(start))
+
+	return nil
 }
 
-func (w *Writer) doPutTelemetry(ctx context.Context) {
+func (w *Writer) doPutTelemetry(ctx context.Context, stream flight.FlightService_DoPutClient, inFlight *inFlightQueue, done chan<- struct{}) {
+	defer close(done)
+	defer func() {
+		// PutResults of the ended stream will never arrive, so its batches no longer count as in flight.
+		w.releaseInFlight(inFlight.clear())
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -80,7 +204,7 @@ func (w *Writer) doPutTelemetry(ctx context.Context) {
 		default:
 		}
 
-		flightPutResult, err := w.flightDoPutClient.Recv()
+		flightPutResult, err := stream.Recv()
 		code := status.Code(err)
 		if errors.Is(err, io.EOF) || code == codes.Canceled || code == codes.Unavailable {
 			return
@@ -96,59 +220,225 @@ func (w *Writer) doPutTelemetry(ctx context.Context) {
 		}
 
 		w.client.logger.Info().Str("appMetadata", string(flightPutResult.GetAppMetadata())).Msg("put result")
+
+		if size, ok := inFlight.pop(); ok {
+			w.releaseInFlight(1, size)
+		}
 	}
 }
 
-func (w *Writer) init(ctx context.Context, rec arrow.Record) error {
+func (w *Writer) init(ctx context.Context, rec arrow.Record) (err error) {
+	ctx, span := startSpan(ctx, spanWriterInit, attributeTableName.String(w.tableName), attributeTransport.String(w.client.spec.WriteTransport))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	ctx, w.cancel = context.WithCancel(ctx)
+	w.streamCancelled = false
 
-	w.client.logger.Info().Str("table", w.tableName).Msg("creating do put client")
-	{
-		var err error
-		if w.flightDoPutClient, err = w.client.flightClient.DoPut(ctx); err != nil {
+	var stream flight.DataStreamWriter
+	if w.exchange != nil {
+		w.client.logger.Info().Str("table", w.tableName).Msg("creating do exchange client")
+		flightDoExchangeClient, err := w.client.flightClient.DoExchange(ctx)
+		if err != nil {
 			w.cancel()
 
-			return fmt.Errorf("failed to create do put client: %w", err)
+			return fmt.Errorf("failed to create do exchange client: %w", err)
 		}
+		w.flightDoExchangeClient = flightDoExchangeClient
+		w.streamDone = make(chan struct{})
+		go w.doExchangeAcks(ctx, flightDoExchangeClient, w.streamDone)
+		stream = flightDoExchangeClient
+	} else {
+		w.client.logger.Info().Str("table", w.tableName).Msg("creating do put client")
+		{
+			var err error
+			if w.flightDoPutClient, err = w.client.flightClient.DoPut(ctx); err != nil {
+				w.cancel()
+
+				return fmt.Errorf("failed to create do put client: %w", err)
+			}
+		}
+		if w.inFlight != nil {
+			// PutResults of the previous stream will never arrive.
+			w.releaseInFlight(w.inFlight.clear())
+		}
+		w.inFlight = &inFlightQueue{}
+		w.streamDone = make(chan struct{})
+		go w.doPutTelemetry(ctx, w.flightDoPutClient, w.inFlight, w.streamDone)
+		stream = w.flightDoPutClient
 	}
-	go w.doPutTelemetry(ctx)
 
 	w.client.logger.Info().Str("table", w.tableName).Msg("creating record writer")
-	w.flightWriter = flight.NewRecordWriter(w.flightDoPutClient, ipc.WithSchema(rec.Schema()))
-	w.flightWriter.SetFlightDescriptor(flightDescriptor(w.tableName))
+	descriptor, err := w.client.putDescriptor(w.tableName, rec)
+	if err != nil {
+		w.cancel()
+
+		return fmt.Errorf("failed to create flight descriptor: %w", err)
+	}
+	w.flightWriter = flight.NewRecordWriter(stream, ipc.WithSchema(rec.Schema()), ipc.WithAllocator(w.client.allocator))
+	w.flightWriter.SetFlightDescriptor(descriptor)
+
+	if w.exchange != nil {
+		// Open the stream with an empty batch so the schema message doesn't carry the app metadata of the first batch.
+		empty := rec.NewSlice(0, 0)
+		defer empty.Release()
+		if err := w.flightWriter.Write(empty); err != nil {
+			w.cancel()
+
+			return fmt.Errorf("failed to open do exchange stream: %w", err)
+		}
+	}
 
 	return nil
 }
 
-func (w *Writer) writeWithRetries(ctx context.Context, rec arrow.Record, attempt int) error {
+// writeBatch writes the batch to the stream. With DoPut, the in-flight limits must be acquired for the batch,
+// which are released by its PutResult, by the end of the stream or if the write fails.
+func (w *Writer) writeBatch(batch recordBatch) error {
+	if w.exchange == nil {
+		if !w.limited() {
+			return w.flightWriter.Write(batch.record)
+		}
+		// The batch is queued before writing it, as its PutResult can arrive before the write returns.
+		id, ok := w.inFlight.push(batch.size)
+		if !ok {
+			// The stream already ended, so the write fails and is retried on a new stream.
+			w.releaseInFlight(1, batch.size)
+		}
+		if err := w.flightWriter.Write(batch.record); err != nil {
+			if size, ok := w.inFlight.remove(id); ok {
+				w.releaseInFlight(1, size)
+			}
+			return err
+		}
+		return nil
+	}
+
+	appMetadata, err := marshalExchangeMetadata(batch.sequence)
+	if err != nil {
+		return fmt.Errorf("failed to marshal exchange metadata: %w", err)
+	}
+	return w.flightWriter.WriteWithAppMetadata(batch.record, appMetadata)
+}
+
+// writeBatchWithTimeout writes the batch, cancelling the stream if the write exceeds the write timeout.
+// A batch written before the stream was cancelled counts as written, and the next write creates a new stream.
+func (w *Writer) writeBatchWithTimeout(batch recordBatch) error {
+	timeout := w.client.spec.Timeouts.Write.Duration()
+	if timeout <= 0 {
+		return w.writeBatch(batch)
+	}
+	timer := time.AfterFunc(timeout, w.cancel)
+	err := w.writeBatch(batch)
+	if timer.Stop() {
+		return err
+	}
+	if err == nil {
+		w.streamCancelled = true
+		return nil
+	}
+	operation := operationDoPut
+	if w.exchange != nil {
+		operation = operationDoExchange
+	}
+	return &TimeoutError{
+		Operation: operation,
+		TableName: w.tableName,
+		Timeout:   timeout,
+		Err:       err,
+	}
+}
+
+func (w *Writer) writeWithRetries(ctx context.Context, batch recordBatch, attempt int) error {
+	retry, err := w.writeAttempt(ctx, batch, attempt)
+	if retry {
+		w.client.metrics.recordRetry(ctx, w.tableName)
+		return w.writeWithRetries(ctx, batch, attempt+1)
+	}
+	return err
+}
+
+// writeAttempt writes the batch once, in its own span. It reports whether the write should be retried,
+// in which case the error is only recorded on the span.
+func (w *Writer) writeAttempt(ctx context.Context, batch recordBatch, attempt int) (retry bool, err error) {
+	ctx, span := startSpan(ctx, spanWriterWrite,
+		attributeTableName.String(w.tableName),
+		attributeAttempt.Int(attempt),
+		attributeBytes.Int64(batch.size),
+		attributeRows.Int64(batch.record.NumRows()),
+	)
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	w.client.logger.Debug().Str("table", w.tableName).Int("attempt", attempt).Msg("writing record")
 
-	if err := w.flightWriter.Write(rec); errors.Is(err, io.EOF) {
+	if w.streamCancelled {
+		if err = w.reinit(ctx, batch); err != nil {
+			if attempt <= maxRetries {
+				w.client.logger.Warn().Err(err).Int("attempt", attempt).Msg("reinitializing writer after write timeout, retrying")
+
+				return true, err
+			}
+			return false, fmt.Errorf("failed to reinitialize writer after write timeout: %w", err)
+		}
+	}
+
+	if w.exchange == nil {
+		if err = w.acquireInFlight(ctx, batch.size); err != nil {
+			return false, fmt.Errorf("failed to wait for in-flight batches: %w", err)
+		}
+	}
+
+	var timeoutErr *TimeoutError
+	if err = w.writeBatchWithTimeout(batch); errors.As(err, &timeoutErr) || errors.Is(err, io.EOF) {
+		writeErr := err
+		if timeoutErr != nil {
+			if attempt > maxRetries {
+				return false, writeErr
+			}
+			w.client.logger.Warn().Err(writeErr).Int("attempt", attempt).Msg("write timed out, reconnecting")
+		}
+
 		w.cancel()
 		if err = w.client.authenticate(ctx); err != nil {
-			return fmt.Errorf("failed to reauthenticate after EOF: %w", err)
+			return false, fmt.Errorf("failed to reauthenticate after EOF: %w", err)
 		}
 
 		// Attempt to reinitialize the writer after EOF
-		time.Sleep(time.Duration(attempt) * writeTimeout)
+		time.Sleep(w.client.retryDelay(attempt))
 
-		if reconnectErr := w.init(ctx, rec); reconnectErr != nil {
+		if reconnectErr := w.reinit(ctx, batch); reconnectErr != nil {
 			if attempt <= maxRetries {
 				w.client.logger.Warn().Err(reconnectErr).Int("attempt", attempt).Msg("reinitializing writer after EOF, retrying")
 
-				return w.writeWithRetries(ctx, rec, attempt+1)
+				return true, reconnectErr
 			} else {
 				w.client.logger.Error().Err(reconnectErr).Msg("failed to reinitialize writer after EOF, giving up")
 
-				return fmt.Errorf("failed to reinitialize writer after EOF: %w", reconnectErr)
+				return false, fmt.Errorf("failed to reinitialize writer after EOF: %w", reconnectErr)
 			}
 		}
 
-		return w.writeWithRetries(ctx, rec, attempt+1)
+		return true, writeErr
 	} else if err != nil {
-		return fmt.Errorf("failed to write record: %w", err)
+		return false, fmt.Errorf("failed to write record: %w", err)
 	}
 
+	return false, nil
+}
+
+// reinit creates a new stream for the batch. With DoExchange, the unacknowledged batches sent before it are resent.
+func (w *Writer) reinit(ctx context.Context, batch recordBatch) error {
+	if err := w.init(ctx, batch.record); err != nil {
+		return err
+	}
+	if w.exchange != nil {
+		if err := w.resendUnacked(batch.sequence); err != nil {
+			return fmt.Errorf("failed to resend unacknowledged batches: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -183,15 +473,3 @@ func (c *Client) getWriter(msg *message.WriteInsert) (*Writer, bool) {
 	writer, ok := c.writers[tableName]
 	return writer, ok
 }
-
-func recordSize(rec arrow.Record) (int, error) {
-	var buf bytes.Buffer
-	writer := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
-	defer func(writer *ipc.Writer) {
-		_ = writer.Close()
-	}(writer)
-	if err := writer.Write(rec); err != nil {
-		return -1, fmt.Errorf("failed to write record: %w", err)
-	}
-	return buf.Len(), nil
-}